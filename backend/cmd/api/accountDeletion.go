@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/gratefulness-app/grace/internal/mailer"
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+var errAccountDeleted = errors.New("this account is scheduled for deletion")
+
+type DeletionResponse struct {
+	PurgeAt time.Time `json:"purge_at"` // when the account is deleted for good
+}
+
+// deleteUserHandler godoc
+//
+// @Summary Delete your account
+// @Description Deactivate the account and sign out everywhere. The account is hidden right away and deleted for good after a grace period, until then the link emailed to the user restores it. Cards the user sent are kept without an author.
+// @Tags users
+// @Produce json
+// @Param userID path int true "User ID"
+// @Success 202 {object} DeletionResponse "Deletion scheduled"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/{userID} [delete]
+func (app *application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	plainToken := uuid.New().String()
+	purgeAt := time.Now().Add(app.config.deletion.gracePeriod)
+
+	if err := app.store.Users.ScheduleDeletion(r.Context(), user.ID, hashToken(plainToken), purgeAt); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, store.EventDeletionRequested, user.ID, map[string]any{"purge_at": purgeAt})
+
+	vars := struct {
+		Username  string
+		PurgeAt   string
+		CancelURL string
+	}{
+		Username:  user.Username,
+		PurgeAt:   purgeAt.UTC().Format("Jan 2, 2006"),
+		CancelURL: fmt.Sprintf("%s/restore/%s", app.config.frontendURL, plainToken),
+	}
+
+	app.background(func() {
+		if err := app.mailer.Send(mailer.AccountDeletionTemplate, user.Username, user.Email, vars); err != nil {
+			log.Printf("error sending account deletion email: %s", err.Error())
+		}
+	})
+
+	if err := app.jsonResponse(w, http.StatusAccepted, DeletionResponse{PurgeAt: purgeAt}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// cancelDeletionHandler godoc
+//
+// @Summary Restore a deleted account
+// @Description Cancel a pending deletion with the token sent in the deletion email
+// @Tags users
+// @Param token path string true "Deletion token"
+// @Success 204 "Account restored"
+// @Failure 404 {object} ErrorResponse "Token not found or expired"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/users/restore/{token} [put]
+func (app *application) cancelDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	userID, err := app.store.Users.CancelDeletion(r.Context(), hashToken(token))
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, store.EventDeletionCanceled, userID, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// purgeDeletedAccounts deletes the accounts past their grace period. It runs
+// every deletion.purgeInterval.
+func (app *application) purgeDeletedAccounts() {
+	ctx := context.Background()
+
+	ids, err := app.store.Users.Purge(ctx)
+	if err != nil {
+		log.Printf("error purging deleted accounts: %s", err.Error())
+		return
+	}
+
+	for _, id := range ids {
+		event := &store.SecurityEvent{UserID: &id, Type: store.EventDeleted}
+		if err := app.store.SecurityEvents.Create(ctx, event); err != nil {
+			log.Printf("error recording security event %s: %s", event.Type, err.Error())
+		}
+	}
+
+	if len(ids) > 0 {
+		log.Printf("purged %d deleted accounts", len(ids))
+	}
+}
@@ -3,29 +3,101 @@ package main
 import (
 	"log"
 	"net/http"
+	"net/netip"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/httprate"
 
+	"github.com/gratefulness-app/grace/internal/auth"
+	"github.com/gratefulness-app/grace/internal/mailer"
+	"github.com/gratefulness-app/grace/internal/oidc"
 	"github.com/gratefulness-app/grace/internal/store"
+	"github.com/gratefulness-app/grace/internal/webauthn"
 )
 
 type application struct {
-	config config
-	store  store.Storage
+	config        config
+	store         store.Storage
+	mailer        mailer.Client
+	authenticator auth.Authenticator
+	oidcProviders map[string]*oidc.Provider
+	webauthn      *webauthn.WebAuthn
 }
 
 type config struct {
-	addr string
-	db   dbConfig
-	env  string
-	mail mailConfig
+	addr         string
+	db           dbConfig
+	env          string
+	mail         mailConfig
+	auth         authConfig
+	oidc         []oidc.Config
+	registration registrationConfig
+	deletion     deletionConfig
+	export       exportConfig
+	frontendURL  string
+
+	// proxies whose X-Forwarded-For and X-Real-IP headers are believed
+	trustedProxies []netip.Prefix
+}
+
+type exportConfig struct {
+	exp           time.Duration // how long a finished export can be downloaded
+	timeout       time.Duration // how long an export may stay pending before it counts as failed
+	purgeInterval time.Duration // how often expired exports are deleted
+}
+
+type deletionConfig struct {
+	gracePeriod   time.Duration // how long a deleted account can still be restored
+	purgeInterval time.Duration // how often accounts past their grace period are purged
+}
+
+type registrationConfig struct {
+	inviteOnly     bool          // registering requires an invite code
+	inviteExp      time.Duration // invite code lifetime
+	maxActiveCodes int           // unused invite codes a user may have at once
+}
+
+type authConfig struct {
+	token    tokenConfig
+	webauthn webauthn.Config
+	lockout  lockoutConfig
+}
+
+type lockoutConfig struct {
+	window        time.Duration // how far back failed attempts are counted
+	freeAttempts  int           // failures allowed before logins are slowed down
+	baseDelay     time.Duration // delay after the first failure past freeAttempts, doubled for each one after
+	maxDelay      time.Duration
+	maxAttempts   int           // failures that lock the account
+	duration      time.Duration // how long a locked account stays locked
+	ipMaxAttempts int           // failures from a single IP before it is blocked
+}
+
+type tokenConfig struct {
+	secret     string
+	exp        time.Duration // access token lifetime
+	refreshExp time.Duration // refresh token lifetime
+	iss        string
 }
 
 type mailConfig struct {
-	exp time.Duration
+	exp            time.Duration // activation link lifetime
+	resetExp       time.Duration // password reset link lifetime
+	emailChangeExp time.Duration // email change confirmation link lifetime
+	loginLinkExp   time.Duration // magic link lifetime
+	unlockExp      time.Duration // account unlock link lifetime
+	fromEmail      string
+	smtp           smtpConfig
+	dir            string // where the log mailer writes emails in development
+}
+
+type smtpConfig struct {
+	host     string
+	port     int
+	username string
+	password string
 }
 
 type dbConfig struct {
@@ -39,7 +111,7 @@ func (app *application) mount() http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(app.RealIPMiddleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
@@ -56,24 +128,190 @@ func (app *application) mount() http.Handler {
 		r.Get("/health", app.healthCheckHandler)
 
 		r.Route("/users", func(r chi.Router) {
+			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Put("/email/{token}", app.confirmEmailHandler)
+			r.Put("/restore/{token}", app.cancelDeletionHandler)
+			r.With(app.AuthTokenMiddleware).Get("/by-username/{username}", app.getUserByUsernameHandler)
+
 			r.Route("/{userID}", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
 				r.Use(app.userContextMiddleware)
 
-				r.Get("/", app.getUserHandler)
-				r.Patch("/", app.updateUserHandler)
-				r.Delete("/", app.deleteUserHandler)
+				r.Group(func(r chi.Router) {
+					r.Use(app.requireAccess(accessProfile))
+
+					r.Get("/", app.getUserHandler)
+					r.Get("/profile", app.getProfileHandler)
+					r.Get("/avatar", app.getAvatarHandler)
+					r.With(app.requireAccess(accessFriends)).Get("/friends", app.listFriendsHandler)
+				})
+
+				r.With(app.authorize(userPolicy)).Patch("/", app.updateUserHandler)
+				r.With(app.authorize(userPolicy)).Delete("/", app.deleteUserHandler)
+
+				r.Put("/block", app.blockUserHandler)
+				r.Delete("/block", app.unblockUserHandler)
+				r.Put("/mute", app.muteUserHandler)
+				r.Delete("/mute", app.unmuteUserHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.requireRole(store.RoleModerator))
+					r.Use(app.authorize(outranksPolicy))
+
+					r.Put("/suspension", app.suspendUserHandler)
+					r.Delete("/suspension", app.unsuspendUserHandler)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.requireRole(store.RoleAdmin))
+
+					r.With(app.authorize(outranksPolicy)).Put("/role", app.updateUserRoleHandler)
+					r.Put("/badges/{badgeID}", app.awardBadgeHandler)
+					r.Delete("/badges/{badgeID}", app.revokeBadgeHandler)
+				})
+			})
+		})
+
+		r.Route("/templates", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/", app.listTemplatesHandler)
+			r.Get("/{templateID}", app.getTemplateHandler)
+			r.With(app.requireRole(store.RoleAdmin)).Post("/", app.createTemplateHandler)
+			r.With(app.requireRole(store.RoleAdmin)).Patch("/{templateID}", app.updateTemplateHandler)
+		})
+
+		r.Route("/badges", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/", app.listBadgesHandler)
+			r.With(app.requireRole(store.RoleAdmin)).Post("/", app.createBadgeHandler)
+		})
+
+		r.Get("/exports/{token}", app.downloadExportHandler)
+
+		r.Route("/security-events", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.requireRole(store.RoleAdmin))
+
+			r.Get("/", app.listSecurityEventsHandler)
+		})
+
+		r.Route("/cards", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Post("/", app.sendCardHandler)
+			r.With(app.requireRole(store.RoleModerator)).Delete("/{cardID}", app.deleteCardHandler)
+		})
+
+		r.Route("/me", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Get("/", app.getMeHandler)
+			r.Put("/password", app.changePasswordHandler)
+			r.Get("/security-events", app.listMySecurityEventsHandler)
+			r.Patch("/profile", app.updateProfileHandler)
+			r.Get("/privacy", app.getPrivacyHandler)
+			r.Patch("/privacy", app.updatePrivacyHandler)
+			r.Put("/avatar", app.updateAvatarHandler)
+			r.Delete("/avatar", app.deleteAvatarHandler)
+			r.Get("/blocks", app.listBlocksHandler)
+			r.Get("/mutes", app.listMutesHandler)
+
+			r.Route("/exports", func(r chi.Router) {
+				r.Get("/", app.listExportsHandler)
+				r.Post("/", app.createExportHandler)
+			})
+
+			r.Route("/invites", func(r chi.Router) {
+				r.Get("/", app.listInvitesHandler)
+				r.Post("/", app.createInviteHandler)
+				r.Get("/users", app.listInviteesHandler)
+				r.Delete("/{inviteID}", app.deleteInviteHandler)
+			})
+
+			r.Route("/identities", func(r chi.Router) {
+				r.Get("/", app.listIdentitiesHandler)
+				r.Post("/{provider}", app.linkIdentityHandler)
+				r.Post("/{provider}/callback", app.linkIdentityCallbackHandler)
+				r.Delete("/{identityID}", app.unlinkIdentityHandler)
+			})
+
+			r.Route("/passkeys", func(r chi.Router) {
+				r.Get("/", app.listPasskeysHandler)
+				r.Post("/", app.registerPasskeyHandler)
+				r.Post("/register", app.beginPasskeyRegistrationHandler)
+				r.Delete("/{passkeyID}", app.deletePasskeyHandler)
+			})
+
+			r.Route("/2fa", func(r chi.Router) {
+				r.Post("/", app.enrolTwoFactorHandler)
+				r.Post("/confirm", app.confirmTwoFactorHandler)
+				r.Delete("/", app.disableTwoFactorHandler)
+			})
+
+			r.Route("/sessions", func(r chi.Router) {
+				r.Get("/", app.listSessionsHandler)
+				r.Delete("/", app.deleteAllSessionsHandler)
+				r.Delete("/{sessionID}", app.deleteSessionHandler)
 			})
 		})
 
 		r.Route("/authentication", func(r chi.Router) {
 			r.Post("/user", app.registerUserHandler)
-
+			r.Post("/token", app.createTokenHandler)
+			r.Post("/token/refresh", app.refreshTokenHandler)
+			r.Post("/token/2fa", app.createMFATokenHandler)
+			r.Post("/magic-link", app.requestMagicLinkHandler)
+			r.Post("/magic-link/{token}", app.magicLinkTokenHandler)
+			r.Post("/passkey/begin", app.beginPasskeyLoginHandler)
+			r.Post("/passkey", app.passkeyLoginHandler)
+			r.Post("/oidc/{provider}", app.startOIDCLoginHandler)
+			r.Post("/oidc/{provider}/callback", app.oidcCallbackHandler)
+			r.Post("/password-reset", app.forgotPasswordHandler)
+			r.Put("/password-reset/{token}", app.resetPasswordHandler)
+			r.Put("/unlock/{token}", app.unlockAccountHandler)
 		})
 	})
 
 	return r
 }
 
+// background runs fn in its own goroutine, recovering from panics so a
+// failing job can't take the server down.
+func (app *application) background(fn func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("background job panicked: %v", err)
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// every runs fn every interval for the lifetime of the server. A run that
+// panics is logged and doesn't stop the later ones.
+func (app *application) every(interval time.Duration, fn func()) {
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			func() {
+				defer func() {
+					if err := recover(); err != nil {
+						log.Printf("periodic job panicked: %v", err)
+					}
+				}()
+
+				fn()
+			}()
+		}
+	})
+}
+
 func (app *application) run(mux http.Handler) error {
 	srv := &http.Server{
 		Addr:         app.config.addr,
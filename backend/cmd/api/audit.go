@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+var errInvalidTimeRange = errors.New("since and until must be RFC 3339 timestamps")
+
+// audit records a security event about the user with the given id, or about
+// no account when it is 0. The actor is the authenticated user, if any.
+// Failing to record an event is logged but doesn't fail the request, the
+// action it describes has already happened.
+func (app *application) audit(r *http.Request, eventType string, userID int64, metadata map[string]any) {
+	event := &store.SecurityEvent{
+		Type:      eventType,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: middleware.GetReqID(r.Context()),
+		Metadata:  metadata,
+	}
+
+	if userID != 0 {
+		event.UserID = &userID
+	}
+
+	if actor := getAuthUserFromCtx(r); actor != nil {
+		event.ActorID = &actor.ID
+	}
+
+	if err := app.store.SecurityEvents.Create(r.Context(), event); err != nil {
+		log.Printf("error recording security event %s: %s", eventType, err.Error())
+	}
+}
+
+// listMySecurityEventsHandler godoc
+//
+// @Summary List security events
+// @Description List the security events of the authenticated user's account, newest first
+// @Tags me
+// @Produce json
+// @Param limit query int false "Page size" default(20)
+// @Param offset query int false "Page offset" default(0)
+// @Success 200 {array} store.SecurityEvent "Security events"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/security-events [get]
+func (app *application) listMySecurityEventsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	limit, offset, err := readPagination(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	events, err := app.store.SecurityEvents.Query(r.Context(), store.SecurityEventFilter{
+		UserID: user.ID,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, events); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// listSecurityEventsHandler godoc
+//
+// @Summary Query security events
+// @Description Query the security events of all accounts, newest first
+// @Tags admin
+// @Produce json
+// @Param user_id query int false "Only events about this user"
+// @Param type query string false "Only events of this type"
+// @Param since query string false "Only events at or after this RFC 3339 time"
+// @Param until query string false "Only events before this RFC 3339 time"
+// @Param limit query int false "Page size" default(20)
+// @Param offset query int false "Page offset" default(0)
+// @Success 200 {array} store.SecurityEvent "Security events"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/security-events [get]
+func (app *application) listSecurityEventsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := readPagination(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := store.SecurityEventFilter{
+		Type:   query.Get("type"),
+		Limit:  limit,
+		Offset: offset,
+	}
+
+	if v := query.Get("user_id"); v != "" {
+		filter.UserID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	if v := query.Get("since"); v != "" {
+		filter.Since, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			app.badRequestResponse(w, r, errInvalidTimeRange)
+			return
+		}
+	}
+
+	if v := query.Get("until"); v != "" {
+		filter.Until, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			app.badRequestResponse(w, r, errInvalidTimeRange)
+			return
+		}
+	}
+
+	events, err := app.store.SecurityEvents.Query(r.Context(), filter)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, events); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -1,18 +1,31 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/gratefulness-app/grace/internal/auth"
+	"github.com/gratefulness-app/grace/internal/mailer"
+	"github.com/gratefulness-app/grace/internal/passwords"
 	"github.com/gratefulness-app/grace/internal/store"
+	"github.com/gratefulness-app/grace/internal/usernames"
 )
 
+var errUserNotVerified = errors.New("user email is not verified")
+
 type RegisterUserPayload struct {
-	Username string `json:"username" validate:"required,max=35"`
+	Username string `json:"username" validate:"required,max=64"`
 	Email    string `json:"email" validate:"required,email,max=255"`
-	Password string `json:"password" validate:"required,min=6,max=72"`
+	Password string `json:"password" validate:"required,min=6,max=256"`
+	// InviteCode is required while registration is invite-only
+	InviteCode string `json:"invite_code" validate:"omitempty,max=64"`
 }
 
 // registerUserHandler godoc
@@ -23,7 +36,7 @@ type RegisterUserPayload struct {
 // @Accept json
 // @Produce json
 // @Param payload body RegisterUserPayload true "User credentials"
-// @Success 201 {object} User "User registered"
+// @Success 201 {object} MeResponse "User registered"
 // @Failure 400 {object} ErrorResponse "Bad request"
 // @Failure 500 {object} ErrorResponse "Internal server error"
 // @Router /v1/users/authentication/user [post]
@@ -39,8 +52,24 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if app.config.registration.inviteOnly && payload.InviteCode == "" {
+		app.failedValidationResponse(w, r, "invite_code", errInviteRequired)
+		return
+	}
+
+	username, err := usernames.Normalize(payload.Username)
+	if err != nil {
+		app.failedValidationResponse(w, r, "username", err)
+		return
+	}
+
+	if err := passwords.Check(payload.Password, username, payload.Email); err != nil {
+		app.failedValidationResponse(w, r, "password", err)
+		return
+	}
+
 	user := &store.User{
-		Username: payload.Username,
+		Username: username,
 		Email:    payload.Email,
 	}
 
@@ -54,13 +83,12 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 
 	plainToken := uuid.New().String()
 
-	hash := sha256.Sum256([]byte(plainToken))
-	hashToken := hex.EncodeToString(hash[:])
-
 	// store the user
-	err := app.store.Users.CreateAndInvite(ctx, user, hashToken, app.config.mail.exp)
+	err = app.store.Users.CreateAndInvite(ctx, user, payload.InviteCode, hashToken(plainToken), app.config.mail.exp)
 	if err != nil {
 		switch err {
+		case store.ErrInvalidInviteCode:
+			app.failedValidationResponse(w, r, "invite_code", err)
 		case store.ErrDuplicateEmail:
 			app.badRequestResponse(w, r, err)
 		case store.ErrDuplicateUsername:
@@ -71,10 +99,280 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	app.audit(r, store.EventRegistered, user.ID, map[string]any{"method": "password"})
+
+	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken)
+
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      user.Username,
+		ActivationURL: activationURL,
+	}
+
 	// send mail
+	if err := app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars); err != nil {
+		log.Printf("error sending welcome email: %s", err.Error())
+
+		// rollback user creation if email fails (SAGA pattern), the invite
+		// code gets its use back
+		if err := app.store.Users.UndoRegistration(ctx, user.ID, payload.InviteCode); err != nil {
+			log.Printf("error deleting user: %s", err.Error())
+		}
+
+		app.internalServerError(w, r, err)
+		return
+	}
 
-	if err := app.jsonResponse(w, http.StatusCreated, user); err != nil {
+	if err := app.jsonResponse(w, http.StatusCreated, newMeResponse(user)); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
+
+type CreateUserTokenPayload struct {
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,min=6,max=256"`
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // access token lifetime in seconds
+}
+
+// createTokenHandler godoc
+//
+// @Summary Create a token
+// @Description Exchange the credentials of a verified user for an access and refresh token
+// @Tags authentication
+// @Accept json
+// @Produce json
+// @Param payload body CreateUserTokenPayload true "User credentials"
+// @Success 201 {object} TokenResponse "Tokens"
+// @Success 200 {object} MFAChallengeResponse "Second factor required"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 429 {object} ErrorResponse "Too many failed attempts"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/authentication/token [post]
+func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateUserTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+	if err != nil && err != store.ErrNotFound {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	retryAfter, err := app.loginRetryAfter(ctx, r, payload.Email, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.rateLimitExceededResponse(w, r, retryAfter)
+		return
+	}
+
+	if user == nil {
+		if err := app.recordLoginFailure(ctx, r, "password", payload.Email, nil); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		app.unauthorizedErrorResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	if err := user.Password.Compare(payload.Password); err != nil {
+		if err := app.recordLoginFailure(ctx, r, "password", payload.Email, user); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	// upgrade bcrypt and outdated argon2id hashes while we have the password.
+	// it's only an upgrade, if it fails the next login tries again
+	if user.Password.NeedsRehash() {
+		if err := app.rehashPassword(ctx, user, payload.Password); err != nil {
+			log.Printf("error rehashing password of user %d: %s", user.ID, err.Error())
+		}
+	}
+
+	if !user.Verified {
+		app.unauthorizedErrorResponse(w, r, errUserNotVerified)
+		return
+	}
+
+	app.completeLogin(w, r, user)
+}
+
+// rehashPassword stores a fresh hash of the user's password, and only sets it
+// on the user once it's saved.
+func (app *application) rehashPassword(ctx context.Context, user *store.User, text string) error {
+	rehashed := *user
+	if err := rehashed.Password.Set(text); err != nil {
+		return err
+	}
+
+	if err := app.store.Users.RehashPassword(ctx, &rehashed); err != nil {
+		return err
+	}
+
+	user.Password = rehashed.Password
+	return nil
+}
+
+// inactiveAccountErr reports why the account can't be used right now, or nil
+// if it can.
+func inactiveAccountErr(user *store.User) error {
+	switch {
+	case user.SuspendedAt != nil:
+		return errAccountSuspended
+	case user.PurgeAt != nil:
+		return errAccountDeleted
+	}
+
+	return nil
+}
+
+// completeLogin finishes a login once the user's first factor was checked:
+// it either asks for a second factor or opens a session.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, user *store.User) {
+	if err := inactiveAccountErr(user); err != nil {
+		app.forbiddenResponse(w, r, err)
+		return
+	}
+
+	// a second factor is required before any session is created
+	if user.TOTPEnabled {
+		app.writeMFAChallenge(w, r, user.ID)
+		return
+	}
+
+	refreshToken, session, err := app.createSession(r, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.writeTokens(w, r, session, refreshToken)
+}
+
+// refreshTokenHandler godoc
+//
+// @Summary Refresh a token
+// @Description Rotate a refresh token, returning a new access and refresh token
+// @Tags authentication
+// @Accept json
+// @Produce json
+// @Param payload body RefreshTokenPayload true "Refresh token"
+// @Success 201 {object} TokenResponse "Tokens"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/authentication/token/refresh [post]
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	session, err := app.store.UserTokens.GetByToken(ctx, hashToken(payload.RefreshToken))
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	refreshToken := uuid.New().String()
+
+	session.UserAgent = r.UserAgent()
+	session.IP = clientIP(r)
+	session.ExpiresAt = time.Now().Add(app.config.auth.token.refreshExp)
+
+	// a refresh token can only be used once
+	if err := app.store.UserTokens.Rotate(ctx, session, hashToken(refreshToken)); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.writeTokens(w, r, session, refreshToken)
+}
+
+// writeTokens signs a new access token for the session and responds with it
+// alongside the plain refresh token.
+func (app *application) writeTokens(w http.ResponseWriter, r *http.Request, session *store.UserToken, refreshToken string) {
+	now := time.Now()
+
+	claims := auth.Claims{
+		Sub: session.UserID,
+		Sid: session.ID,
+		Exp: now.Add(app.config.auth.token.exp).Unix(),
+		Iat: now.Unix(),
+		Nbf: now.Unix(),
+		Iss: app.config.auth.token.iss,
+		Aud: app.config.auth.token.iss,
+	}
+
+	accessToken, err := app.authenticator.GenerateToken(claims)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	res := TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(app.config.auth.token.exp.Seconds()),
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// hashToken returns the hex encoded sha256 of a plain token. Only the hash is
+// ever persisted; the plain token is what gets sent to the user.
+func hashToken(plainToken string) string {
+	hash := sha256.Sum256([]byte(plainToken))
+	return hex.EncodeToString(hash[:])
+}
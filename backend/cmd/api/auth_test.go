@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+// fakeRehashUsers pretends to save rehashed passwords, or fails with err.
+type fakeRehashUsers struct {
+	*store.UserStore
+
+	err error
+}
+
+func (f fakeRehashUsers) RehashPassword(ctx context.Context, user *store.User) error {
+	return f.err
+}
+
+func TestRehashPassword(t *testing.T) {
+	ctx := context.Background()
+	errDown := errors.New("database is down")
+
+	app := &application{store: store.Storage{Users: fakeRehashUsers{err: errDown}}}
+	user := &store.User{ID: 1}
+
+	// the old hash stays until the new one is saved
+	if err := app.rehashPassword(ctx, user, "hunter2"); err != errDown {
+		t.Fatalf("rehashPassword() = %v, want %v", err, errDown)
+	}
+	if !user.Password.NeedsRehash() {
+		t.Fatal("the unsaved hash was set on the user")
+	}
+
+	app.store.Users = fakeRehashUsers{}
+
+	if err := app.rehashPassword(ctx, user, "hunter2"); err != nil {
+		t.Fatalf("rehashPassword() = %v", err)
+	}
+	if user.Password.NeedsRehash() || user.Password.Compare("hunter2") != nil {
+		t.Fatal("the saved hash wasn't set on the user")
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+type CreateBadgePayload struct {
+	Title       string `json:"title" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=255"`
+	Icon        string `json:"icon" validate:"omitempty,url,max=255"`
+}
+
+// listBadgesHandler godoc
+//
+// @Summary List badges
+// @Tags badges
+// @Produce json
+// @Success 200 {array} store.Badge "Badges"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/badges [get]
+func (app *application) listBadgesHandler(w http.ResponseWriter, r *http.Request) {
+	badges, err := app.store.Badges.ListAll(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, badges); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// createBadgeHandler godoc
+//
+// @Summary Create a badge
+// @Tags badges
+// @Accept json
+// @Produce json
+// @Param payload body CreateBadgePayload true "Badge"
+// @Success 201 {object} store.Badge "Badge created"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/badges [post]
+func (app *application) createBadgeHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateBadgePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	badge := &store.Badge{
+		Title:       payload.Title,
+		Description: payload.Description,
+		Icon:        payload.Icon,
+	}
+
+	if err := app.store.Badges.Add(r.Context(), badge); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, badge); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// awardBadgeHandler godoc
+//
+// @Summary Award a badge to a user
+// @Tags badges
+// @Produce json
+// @Param userID path int true "User ID"
+// @Param badgeID path int true "Badge ID"
+// @Success 201 {object} store.UserBadge "Badge awarded"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User or badge not found"
+// @Failure 409 {object} ErrorResponse "User already has the badge"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/{userID}/badges/{badgeID} [put]
+func (app *application) awardBadgeHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "badgeID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	if _, err := app.store.Badges.GetByID(ctx, id); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	userBadge := &store.UserBadge{
+		UserId:  user.ID,
+		BadgeId: id,
+	}
+
+	if err := app.store.UserBadges.Award(ctx, userBadge); err != nil {
+		switch err {
+		case store.ErrDuplicateBadge:
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, userBadge); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// revokeBadgeHandler godoc
+//
+// @Summary Take a badge away from a user
+// @Tags badges
+// @Param userID path int true "User ID"
+// @Param badgeID path int true "Badge ID"
+// @Success 204 "Badge revoked"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User doesn't have the badge"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/{userID}/badges/{badgeID} [delete]
+func (app *application) revokeBadgeHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "badgeID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.UserBadges.Delete(r.Context(), user.ID, id); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
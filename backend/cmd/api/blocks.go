@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+var (
+	errBlockSelf = errors.New("you can't block yourself")
+	errMuteSelf  = errors.New("you can't mute yourself")
+)
+
+// blockUserHandler godoc
+//
+// @Summary Block a user
+// @Description Removes every friend and follower relationship between you and the user. Neither of you can see the other's profile or send the other cards until the block is lifted.
+// @Tags users
+// @Param userID path int true "User ID"
+// @Success 204 "User blocked"
+// @Failure 400 {object} ErrorResponse "Can't block yourself"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/{userID}/block [put]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+	blocked := getUserFromCtx(r)
+
+	if user.ID == blocked.ID {
+		app.badRequestResponse(w, r, errBlockSelf)
+		return
+	}
+
+	if err := app.store.Blocks.Block(r.Context(), user.ID, blocked.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unblockUserHandler godoc
+//
+// @Summary Unblock a user
+// @Description Relationships removed by the block aren't restored
+// @Tags users
+// @Param userID path int true "User ID"
+// @Success 204 "User unblocked"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "User not found or not blocked"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/{userID}/block [delete]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+	blocked := getUserFromCtx(r)
+
+	if err := app.store.Blocks.Unblock(r.Context(), user.ID, blocked.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// muteUserHandler godoc
+//
+// @Summary Mute a user
+// @Description Cards from the user are still delivered, but arrive already read and without an email. Relationships are kept.
+// @Tags users
+// @Param userID path int true "User ID"
+// @Success 204 "User muted"
+// @Failure 400 {object} ErrorResponse "Can't mute yourself"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/{userID}/mute [put]
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+	muted := getUserFromCtx(r)
+
+	if user.ID == muted.ID {
+		app.badRequestResponse(w, r, errMuteSelf)
+		return
+	}
+
+	if err := app.store.Mutes.Mute(r.Context(), user.ID, muted.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unmuteUserHandler godoc
+//
+// @Summary Unmute a user
+// @Tags users
+// @Param userID path int true "User ID"
+// @Success 204 "User unmuted"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "User not found or not muted"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/{userID}/mute [delete]
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+	muted := getUserFromCtx(r)
+
+	if err := app.store.Mutes.Unmute(r.Context(), user.ID, muted.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listBlocksHandler godoc
+//
+// @Summary List blocked users
+// @Tags me
+// @Produce json
+// @Param limit query int false "Page size" default(20)
+// @Param offset query int false "Page offset" default(0)
+// @Success 200 {array} UserResponse "Blocked users"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/blocks [get]
+func (app *application) listBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	limit, offset, err := readPagination(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	blocked, err := app.store.Blocks.GetByUserID(r.Context(), user.ID, limit, offset)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	res := make([]UserResponse, len(blocked))
+	for i, u := range blocked {
+		res[i] = newUserResponse(u)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// listMutesHandler godoc
+//
+// @Summary List muted users
+// @Tags me
+// @Produce json
+// @Param limit query int false "Page size" default(20)
+// @Param offset query int false "Page offset" default(0)
+// @Success 200 {array} UserResponse "Muted users"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/mutes [get]
+func (app *application) listMutesHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	limit, offset, err := readPagination(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	muted, err := app.store.Mutes.GetByUserID(r.Context(), user.ID, limit, offset)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	res := make([]UserResponse, len(muted))
+	for i, u := range muted {
+		res[i] = newUserResponse(u)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
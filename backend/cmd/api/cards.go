@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gratefulness-app/grace/internal/mailer"
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+var errTemplateNotFound = errors.New("does not exist")
+
+type SendCardPayload struct {
+	RecipientID int64           `json:"recipient_id" validate:"required"`
+	TemplateID  int64           `json:"template_id" validate:"required"`
+	Title       string          `json:"title" validate:"required,max=255"`
+	Data        json.RawMessage `json:"data" validate:"required"`
+}
+
+// sendCardHandler godoc
+//
+// @Summary Send a card
+// @Description Send a card to another user, if their privacy settings let you. Users that blocked you, or that you blocked, can't be found.
+// @Tags cards
+// @Accept json
+// @Produce json
+// @Param payload body SendCardPayload true "Card and recipient"
+// @Success 201 {object} store.Card "Card sent"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "The recipient doesn't accept cards from you"
+// @Failure 404 {object} ErrorResponse "Recipient not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/cards [post]
+func (app *application) sendCardHandler(w http.ResponseWriter, r *http.Request) {
+	sender := getAuthUserFromCtx(r)
+
+	var payload SendCardPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	recipient, err := app.store.Users.GetByID(ctx, payload.RecipientID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// suspended and deleted accounts can't receive anything
+	if inactiveAccountErr(recipient) != nil {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	if err := app.checkAccess(ctx, sender, recipient.ID, accessSendCard); err != nil {
+		app.accessErrorResponse(w, r, err)
+		return
+	}
+
+	if _, err := app.store.Templates.GetByID(ctx, payload.TemplateID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.failedValidationResponse(w, r, "template_id", errTemplateNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	card := &store.Card{
+		Title:      payload.Title,
+		Data:       payload.Data,
+		TemplateId: payload.TemplateID,
+		UserId:     &sender.ID,
+	}
+
+	notify, err := app.store.Cards.Send(ctx, card, recipient.ID)
+	if err != nil {
+		switch err {
+		case store.ErrBlocked:
+			// blocked after the access check, answered the same way
+			app.notFoundResponse(w, r, store.ErrNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// no email about cards from a sender the recipient muted
+	if notify {
+		vars := struct {
+			Username       string
+			SenderUsername string
+			CardTitle      string
+			CardURL        string
+		}{
+			Username:       recipient.Username,
+			SenderUsername: sender.Username,
+			CardTitle:      card.Title,
+			CardURL:        fmt.Sprintf("%s/cards/%d", app.config.frontendURL, card.ID),
+		}
+
+		app.background(func() {
+			if err := app.mailer.Send(mailer.CardReceivedTemplate, recipient.Username, recipient.Email, vars); err != nil {
+				log.Printf("error sending card received email: %s", err.Error())
+			}
+		})
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, card); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
@@ -17,8 +20,51 @@ func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Reques
 	writeJSONError(w, http.StatusBadRequest, err.Error())
 }
 
+// failedValidationResponse reports a value that is well-formed but not
+// acceptable, naming the JSON field so clients can show it next to the input.
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, field string, err error) {
+	log.Printf("validation error: %s path: %s field: %s error: %s", r.Method, r.URL.Path, field, err.Error())
+
+	type envelope struct {
+		Error string `json:"error"`
+		Field string `json:"field"`
+	}
+
+	writeJSON(w, http.StatusBadRequest, &envelope{Error: field + " " + err.Error(), Field: field})
+}
+
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request, err error) {
 	log.Printf("not found error: %s path: %s error: %s", r.Method, r.URL.Path, err.Error())
 
 	writeJSONError(w, http.StatusNotFound, "Resource not found.")
 }
+
+func (app *application) unauthorizedErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("unauthorized error: %s path: %s error: %s", r.Method, r.URL.Path, err.Error())
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="restricted"`)
+
+	writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+}
+
+func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("forbidden error: %s path: %s error: %s", r.Method, r.URL.Path, err.Error())
+
+	writeJSONError(w, http.StatusForbidden, "forbidden")
+}
+
+func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("conflict error: %s path: %s error: %s", r.Method, r.URL.Path, err.Error())
+
+	writeJSONError(w, http.StatusConflict, err.Error())
+}
+
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	log.Printf("rate limit exceeded: %s path: %s retry after: %s", r.Method, r.URL.Path, retryAfter)
+
+	// round up so clients never retry a moment too early
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded, retry after: "+strconv.Itoa(seconds)+"s")
+}
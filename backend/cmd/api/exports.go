@@ -0,0 +1,338 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/gratefulness-app/grace/internal/mailer"
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+const exportPageSize = 100
+
+const exportReadme = `This archive holds everything your Grace account contained when it was
+exported.
+
+account.json         your account
+profile.json         your profile
+avatar.*             your avatar, if you uploaded one
+cards/sent.json      the cards you sent
+cards/received.json  the cards you received
+friends.json         your friends
+followers.json       the users following you
+following.json       the users you follow
+badges.json          the badges you earned
+notifications.json   your notifications
+
+Cards are kept in the format the app draws them from, in their "data"
+field. Grace doesn't store pictures of cards, so there are no images to
+include; badges link to theirs in "image_url".
+`
+
+// listExportsHandler godoc
+//
+// @Summary List data exports
+// @Description List the exports of the authenticated user's data that haven't expired yet
+// @Tags me
+// @Produce json
+// @Success 200 {array} store.DataExport "Data exports"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/exports [get]
+func (app *application) listExportsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	exports, err := app.store.DataExports.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, exports); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// createExportHandler godoc
+//
+// @Summary Export your data
+// @Description Start building a ZIP archive of the authenticated user's data. The download link is emailed once it is ready.
+// @Tags me
+// @Produce json
+// @Success 202 {object} store.DataExport "Export started"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 409 {object} ErrorResponse "An export is already in progress"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/exports [post]
+func (app *application) createExportHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	// an export that never finishes expires like any other, so it can't block
+	// new ones forever
+	export := &store.DataExport{
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(app.config.export.exp),
+	}
+
+	if err := app.store.DataExports.Create(r.Context(), export); err != nil {
+		switch err {
+		case store.ErrExportInProgress:
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.background(func() {
+		if err := app.buildExport(export, user); err != nil {
+			log.Printf("error exporting data of user %d: %s", user.ID, err.Error())
+
+			if err := app.store.DataExports.Fail(context.Background(), export.ID); err != nil {
+				log.Printf("error marking export %d as failed: %s", export.ID, err.Error())
+			}
+		}
+	})
+
+	if err := app.jsonResponse(w, http.StatusAccepted, export); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// downloadExportHandler godoc
+//
+// @Summary Download a data export
+// @Description Download the archive with the token from the email sent when it was ready
+// @Tags exports
+// @Produce application/zip
+// @Param token path string true "Download token"
+// @Success 200 {file} file "ZIP archive"
+// @Failure 404 {object} ErrorResponse "Token not found or expired"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/exports/{token} [get]
+func (app *application) downloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	export, err := app.store.DataExports.GetByToken(r.Context(), hashToken(token))
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, store.EventDataExported, export.UserID, map[string]any{"export_id": export.ID})
+
+	filename := fmt.Sprintf("grace-%s.zip", export.CreatedAt.UTC().Format("2006-01-02"))
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.FormatInt(export.Size, 10))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(export.Archive); err != nil {
+		log.Printf("error sending export %d: %s", export.ID, err.Error())
+	}
+}
+
+// buildExport collects the user's data into a ZIP archive, stores it and
+// emails the user a link to download it.
+func (app *application) buildExport(export *store.DataExport, user *store.User) error {
+	ctx := context.Background()
+
+	sent, err := collectAll(func(limit, offset int) ([]*store.Card, error) {
+		return app.store.Cards.GetByUserID(ctx, user.ID, limit, offset)
+	})
+	if err != nil {
+		return err
+	}
+
+	received, err := collectAll(func(limit, offset int) ([]*store.Card, error) {
+		return app.store.Cards.GetReceivedByUserID(ctx, user.ID, limit, offset)
+	})
+	if err != nil {
+		return err
+	}
+
+	friends, err := collectAll(func(limit, offset int) ([]*store.User, error) {
+		return app.store.Friends.GetByUserID(ctx, user.ID, limit, offset)
+	})
+	if err != nil {
+		return err
+	}
+
+	followers, err := collectAll(func(limit, offset int) ([]*store.User, error) {
+		return app.store.Followers.GetFollowers(ctx, user.ID, limit, offset)
+	})
+	if err != nil {
+		return err
+	}
+
+	following, err := collectAll(func(limit, offset int) ([]*store.User, error) {
+		return app.store.Followers.GetFollowing(ctx, user.ID, limit, offset)
+	})
+	if err != nil {
+		return err
+	}
+
+	profile, err := app.store.Profiles.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	avatar, err := app.store.Profiles.GetAvatar(ctx, user.ID)
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+
+	badges, err := app.store.UserBadges.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	notifications, err := collectAll(func(limit, offset int) ([]*store.Notification, error) {
+		return app.store.Notifications.GetByUserID(ctx, user.ID, limit, offset)
+	})
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	now := time.Now()
+
+	readme, err := archive.CreateHeader(&zip.FileHeader{Name: "README.txt", Method: zip.Deflate, Modified: now})
+	if err != nil {
+		return err
+	}
+
+	if _, err := readme.Write([]byte(exportReadme)); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"account.json", newMeResponse(user)},
+		{"profile.json", newProfileResponse(profile, true, true)},
+		{"cards/sent.json", sent},
+		{"cards/received.json", received},
+		{"friends.json", friends},
+		{"followers.json", followers},
+		{"following.json", following},
+		{"badges.json", badges},
+		{"notifications.json", notifications},
+	}
+
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.data); err != nil {
+			return err
+		}
+	}
+
+	if avatar != nil {
+		name := "avatar." + strings.TrimPrefix(avatar.ContentType, "image/")
+
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: avatar.UpdatedAt})
+		if err != nil {
+			return err
+		}
+
+		if _, err := f.Write(avatar.Data); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	plainToken := uuid.New().String()
+	export.Archive = buf.Bytes()
+	export.ExpiresAt = time.Now().Add(app.config.export.exp)
+
+	if err := app.store.DataExports.Complete(ctx, export, hashToken(plainToken)); err != nil {
+		return err
+	}
+
+	vars := struct {
+		Username    string
+		ExpiresAt   string
+		DownloadURL string
+	}{
+		Username:    user.Username,
+		ExpiresAt:   export.ExpiresAt.UTC().Format("Jan 2, 2006 at 15:04 MST"),
+		DownloadURL: fmt.Sprintf("%s/exports/%s", app.config.frontendURL, plainToken),
+	}
+
+	if err := app.mailer.Send(mailer.DataExportTemplate, user.Username, user.Email, vars); err != nil {
+		log.Printf("error sending data export email: %s", err.Error())
+	}
+
+	return nil
+}
+
+// purgeExpiredExports deletes the exports that can't be downloaded anymore
+// and fails those stuck pending, so the user can request a new one. It runs
+// every export.purgeInterval.
+func (app *application) purgeExpiredExports() {
+	ctx := context.Background()
+
+	stale, err := app.store.DataExports.FailStale(ctx, time.Now().Add(-app.config.export.timeout))
+	if err != nil {
+		log.Printf("error failing stale exports: %s", err.Error())
+	} else if stale > 0 {
+		log.Printf("failed %d stale exports", stale)
+	}
+
+	n, err := app.store.DataExports.DeleteExpired(ctx)
+	if err != nil {
+		log.Printf("error purging expired exports: %s", err.Error())
+		return
+	}
+
+	if n > 0 {
+		log.Printf("purged %d expired exports", n)
+	}
+}
+
+// collectAll pages through a list until it runs out.
+func collectAll[T any](fetch func(limit, offset int) ([]T, error)) ([]T, error) {
+	var all []T
+
+	for offset := 0; ; offset += exportPageSize {
+		page, err := fetch(exportPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, page...)
+
+		if len(page) < exportPageSize {
+			return all, nil
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+)
+
+// listFriendsHandler godoc
+//
+// @Summary List a user's friends
+// @Description Only shown to the audience the user opened their friends list up to
+// @Tags users
+// @Produce json
+// @Param userID path int true "User ID"
+// @Param limit query int false "Page size" default(20)
+// @Param offset query int false "Page offset" default(0)
+// @Success 200 {array} UserResponse "Friends"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Friends list is hidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/{userID}/friends [get]
+func (app *application) listFriendsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	limit, offset, err := readPagination(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	friends, err := app.store.Friends.GetByUserID(r.Context(), user.ID, limit, offset)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	res := make([]UserResponse, len(friends))
+	for i, friend := range friends {
+		res[i] = newUserResponse(friend)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+var (
+	errInviteRequired  = errors.New("is required, registration is invite-only")
+	errTooManyInvites  = errors.New("you have too many unused invite codes, revoke one first")
+	inviteCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+type CreateInvitePayload struct {
+	MaxUses int `json:"max_uses" validate:"omitempty,min=1,max=50"`
+}
+
+// listInvitesHandler godoc
+//
+// @Summary List invite codes
+// @Description List the invite codes the authenticated user generated
+// @Tags me
+// @Produce json
+// @Success 200 {array} store.InviteCode "Invite codes"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/invites [get]
+func (app *application) listInvitesHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	invites, err := app.store.Invites.GetByCreator(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, invites); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// createInviteHandler godoc
+//
+// @Summary Generate an invite code
+// @Tags me
+// @Accept json
+// @Produce json
+// @Param payload body CreateInvitePayload true "How many accounts the code may create, 1 by default"
+// @Success 201 {object} store.InviteCode "Invite code"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 409 {object} ErrorResponse "Too many unused invite codes"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/invites [post]
+func (app *application) createInviteHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	var payload CreateInvitePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	active, err := app.store.Invites.CountActiveByCreator(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if active >= app.config.registration.maxActiveCodes {
+		app.conflictResponse(w, r, errTooManyInvites)
+		return
+	}
+
+	code := make([]byte, 10)
+	if _, err := rand.Read(code); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	invite := &store.InviteCode{
+		Code:      inviteCodeEncoding.EncodeToString(code),
+		CreatedBy: user.ID,
+		MaxUses:   max(payload.MaxUses, 1),
+		ExpiresAt: time.Now().Add(app.config.registration.inviteExp),
+	}
+
+	if err := app.store.Invites.Create(ctx, invite); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, invite); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteInviteHandler godoc
+//
+// @Summary Revoke an invite code
+// @Tags me
+// @Param inviteID path int true "Invite code ID"
+// @Success 204 "Invite code revoked"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Invite code not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/invites/{inviteID} [delete]
+func (app *application) deleteInviteHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "inviteID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Invites.Delete(r.Context(), id, user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listInviteesHandler godoc
+//
+// @Summary List invited users
+// @Description List the users that registered with one of the authenticated user's invite codes
+// @Tags me
+// @Produce json
+// @Success 200 {array} UserResponse "Invited users"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/invites/users [get]
+func (app *application) listInviteesHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	invitees, err := app.store.Users.GetByInviter(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	res := make([]UserResponse, len(invitees))
+	for i, invitee := range invitees {
+		res[i] = newUserResponse(invitee)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/go-playground/validator/v10"
 )
 
 var Validate *validator.Validate
 
+var errInvalidPagination = errors.New("limit must be between 1 and 100 and offset can't be negative")
+
 func init() {
 	Validate = validator.New(validator.WithRequiredStructEnabled())
 }
@@ -30,6 +34,30 @@ func readJSON(w http.ResponseWriter, r *http.Request, data any) error {
 	return decoder.Decode(data)
 }
 
+// readPagination reads the limit and offset query parameters, defaulting to
+// the first 20 results.
+func readPagination(r *http.Request) (int, int, error) {
+	limit, offset := 20, 0
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			return 0, 0, errInvalidPagination
+		}
+		limit = n
+	}
+
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, errInvalidPagination
+		}
+		offset = n
+	}
+
+	return limit, offset, nil
+}
+
 func writeJSONError(w http.ResponseWriter, status int, message string) error {
 	type envelope struct {
 		Error string `json:"error"`
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/gratefulness-app/grace/internal/mailer"
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+// loginRetryAfter reports how long the client has to wait before it may try
+// to sign in again, or 0 if it may try right away. The delay is keyed on the
+// submitted email whether or not it has an account, so it doesn't tell which
+// emails are registered; user is nil when it has none. Passkey, magic link and
+// OIDC sign-ins have no email and are only throttled by IP address.
+//
+// The IP limit is advisory: an attacker with many addresses gets around it.
+// The delays and the lock per email are what protect an account.
+func (app *application) loginRetryAfter(ctx context.Context, r *http.Request, email string, user *store.User) (time.Duration, error) {
+	cfg := app.config.auth.lockout
+	now := time.Now()
+	since := now.Add(-cfg.window)
+
+	byIP, err := app.store.LoginAttempts.FailuresByIP(ctx, clientIP(r), since)
+	if err != nil {
+		return 0, err
+	}
+
+	if byIP.Count >= cfg.ipMaxAttempts {
+		return byIP.Last.Add(cfg.window).Sub(now), nil
+	}
+
+	if email == "" {
+		return 0, nil
+	}
+
+	if user != nil && user.LockedUntil != nil && user.LockedUntil.After(now) {
+		return user.LockedUntil.Sub(now), nil
+	}
+
+	byEmail, err := app.store.LoginAttempts.FailuresByEmail(ctx, loginEmailHash(email), since)
+	if err != nil {
+		return 0, err
+	}
+
+	// an email without an account looks locked like an account would
+	if user == nil && byEmail.Count >= cfg.maxAttempts {
+		if wait := byEmail.Last.Add(cfg.duration).Sub(now); wait > 0 {
+			return wait, nil
+		}
+	}
+
+	if wait := byEmail.Last.Add(loginDelay(cfg, byEmail.Count)).Sub(now); wait > 0 {
+		return wait, nil
+	}
+
+	return 0, nil
+}
+
+// loginDelay is how long to wait after the last of n failed attempts. It
+// doubles with every failure past the free ones.
+func loginDelay(cfg lockoutConfig, n int) time.Duration {
+	if n < cfg.freeAttempts {
+		return 0
+	}
+
+	delay := cfg.baseDelay
+	for i := cfg.freeAttempts; i < n && delay < cfg.maxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, cfg.maxDelay)
+}
+
+// recordLoginFailure counts a failed attempt for the email and locks the
+// account once it reached the limit. method is how the user tried to sign
+// in. user is nil when the email has no account, email is empty when the
+// attempt wasn't for one.
+func (app *application) recordLoginFailure(ctx context.Context, r *http.Request, method, email string, user *store.User) error {
+	cfg := app.config.auth.lockout
+
+	var userID int64
+	if user != nil {
+		userID = user.ID
+	}
+
+	var emailHash string
+	if email != "" {
+		emailHash = loginEmailHash(email)
+	}
+
+	if err := app.store.LoginAttempts.Record(ctx, userID, emailHash, clientIP(r)); err != nil {
+		return err
+	}
+
+	app.audit(r, store.EventLoginFailed, userID, map[string]any{"method": method})
+
+	if user == nil || emailHash == "" {
+		return nil
+	}
+
+	byEmail, err := app.store.LoginAttempts.FailuresByEmail(ctx, emailHash, time.Now().Add(-cfg.window))
+	if err != nil {
+		return err
+	}
+
+	if byEmail.Count < cfg.maxAttempts {
+		return nil
+	}
+
+	return app.lockAccount(ctx, r, user)
+}
+
+// countLoginFailure records a failed sign-in that isn't tied to an email,
+// such as a bad passkey or magic link, against the client's IP address. It
+// has responded when ok is false.
+func (app *application) countLoginFailure(w http.ResponseWriter, r *http.Request, method string) bool {
+	if err := app.recordLoginFailure(r.Context(), r, method, "", nil); err != nil {
+		app.internalServerError(w, r, err)
+		return false
+	}
+
+	return true
+}
+
+// throttleLogin responds with 429 when the client's IP address failed to
+// sign in too often. It has responded when ok is false.
+func (app *application) throttleLogin(w http.ResponseWriter, r *http.Request) bool {
+	retryAfter, err := app.loginRetryAfter(r.Context(), r, "", nil)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return false
+	}
+
+	if retryAfter > 0 {
+		app.rateLimitExceededResponse(w, r, retryAfter)
+		return false
+	}
+
+	return true
+}
+
+// lockAccount locks the user out for a while and emails them a link to
+// unlock the account early.
+func (app *application) lockAccount(ctx context.Context, r *http.Request, user *store.User) error {
+	plainToken := uuid.New().String()
+	until := time.Now().Add(app.config.auth.lockout.duration)
+
+	if err := app.store.LoginAttempts.Lock(ctx, user.ID, until, hashToken(plainToken), app.config.mail.unlockExp); err != nil {
+		return err
+	}
+
+	app.audit(r, store.EventAccountLocked, user.ID, map[string]any{"locked_until": until})
+
+	vars := struct {
+		Username    string
+		LockedUntil string
+		UnlockURL   string
+	}{
+		Username:    user.Username,
+		LockedUntil: until.UTC().Format("Jan 2, 2006 at 15:04 MST"),
+		UnlockURL:   fmt.Sprintf("%s/unlock/%s", app.config.frontendURL, plainToken),
+	}
+
+	app.background(func() {
+		if err := app.mailer.Send(mailer.AccountLockedTemplate, user.Username, user.Email, vars); err != nil {
+			log.Printf("error sending account locked email: %s", err.Error())
+		}
+	})
+
+	return nil
+}
+
+// unlockAccountHandler godoc
+//
+// @Summary Unlock an account
+// @Description Lift a lockout caused by too many failed logins with the token sent in the lockout email
+// @Tags authentication
+// @Param token path string true "Unlock token"
+// @Success 204 "Account unlocked"
+// @Failure 404 {object} ErrorResponse "Token not found or expired"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/authentication/unlock/{token} [put]
+func (app *application) unlockAccountHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	userID, err := app.store.LoginAttempts.Unlock(r.Context(), hashToken(token))
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, store.EventAccountUnlocked, userID, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loginEmailHash is the key failed logins for an email are counted under.
+// Emails are case-insensitive, so are the counts.
+func loginEmailHash(email string) string {
+	return hashToken(strings.ToLower(email))
+}
+
+// clientIP is the request's IP address without the port. RealIPMiddleware has
+// already replaced RemoteAddr with the forwarded address when a trusted proxy
+// sent one.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gratefulness-app/grace/internal/store"
+	"github.com/gratefulness-app/grace/internal/webauthn"
+)
+
+var testLockout = lockoutConfig{
+	window:        time.Minute * 15,
+	freeAttempts:  3,
+	baseDelay:     time.Second,
+	maxDelay:      time.Minute,
+	maxAttempts:   10,
+	duration:      time.Minute * 30,
+	ipMaxAttempts: 50,
+}
+
+type loginAttempt struct {
+	userID    int64
+	emailHash string
+	ip        string
+	at        time.Time
+}
+
+// fakeLoginAttempts keeps failed logins in memory.
+type fakeLoginAttempts struct {
+	*store.LoginAttemptStore
+
+	mu       sync.Mutex
+	attempts []loginAttempt
+}
+
+func (f *fakeLoginAttempts) Record(ctx context.Context, userID int64, emailHash, ip string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.attempts = append(f.attempts, loginAttempt{userID, emailHash, ip, time.Now()})
+	return nil
+}
+
+func (f *fakeLoginAttempts) FailuresByEmail(ctx context.Context, emailHash string, since time.Time) (*store.FailedLogins, error) {
+	return f.failures(since, func(a loginAttempt) bool { return a.emailHash == emailHash }), nil
+}
+
+func (f *fakeLoginAttempts) FailuresByIP(ctx context.Context, ip string, since time.Time) (*store.FailedLogins, error) {
+	return f.failures(since, func(a loginAttempt) bool { return a.ip == ip }), nil
+}
+
+func (f *fakeLoginAttempts) failures(since time.Time, match func(loginAttempt) bool) *store.FailedLogins {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var failed store.FailedLogins
+	for _, a := range f.attempts {
+		if match(a) && a.at.After(since) {
+			failed.Count++
+			failed.Last = a.at
+		}
+	}
+	return &failed
+}
+
+// fakeSecurityEvents keeps the audit log in memory.
+type fakeSecurityEvents struct {
+	*store.SecurityEventStore
+
+	mu     sync.Mutex
+	events []*store.SecurityEvent
+}
+
+func (f *fakeSecurityEvents) Create(ctx context.Context, event *store.SecurityEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *fakeSecurityEvents) count(eventType string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, e := range f.events {
+		if e.Type == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+// fakeLoginUsers knows no magic links.
+type fakeLoginUsers struct {
+	*store.UserStore
+}
+
+func (fakeLoginUsers) ConsumeLoginLink(ctx context.Context, token string) (int64, error) {
+	return 0, store.ErrNotFound
+}
+
+// fakePasskeys knows no challenges.
+type fakePasskeys struct {
+	*store.PasskeyStore
+}
+
+func (fakePasskeys) ConsumeChallenge(ctx context.Context, challenge, typ string) (*store.WebAuthnChallenge, error) {
+	return nil, store.ErrNotFound
+}
+
+func newLockoutApp() (*application, *fakeLoginAttempts, *fakeSecurityEvents) {
+	attempts := &fakeLoginAttempts{}
+	events := &fakeSecurityEvents{}
+
+	app := &application{
+		store: store.Storage{
+			Users:          fakeLoginUsers{},
+			Passkeys:       fakePasskeys{},
+			LoginAttempts:  attempts,
+			SecurityEvents: events,
+		},
+	}
+	app.config.auth.lockout = testLockout
+
+	return app, attempts, events
+}
+
+func TestLoginRetryAfter(t *testing.T) {
+	ctx := context.Background()
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+
+	app, _, _ := newLockoutApp()
+	jane := &store.User{ID: 1, Email: "jane@example.com"}
+
+	// the delays must not tell an email with an account from one without
+	for n := 1; n < testLockout.maxAttempts; n++ {
+		if err := app.recordLoginFailure(ctx, r, "password", jane.Email, jane); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.recordLoginFailure(ctx, r, "password", "nobody@example.com", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		known, err := app.loginRetryAfter(ctx, r, jane.Email, jane)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		unknown, err := app.loginRetryAfter(ctx, r, "nobody@example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := loginDelay(testLockout, n)
+		if known.Round(time.Second) != want || unknown.Round(time.Second) != want {
+			t.Fatalf("after %d failures: got %s for an account and %s without, want %s", n, known, unknown, want)
+		}
+	}
+
+	// one more locks the account, and an email without one looks the same
+	if err := app.recordLoginFailure(ctx, r, "password", "nobody@example.com", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	wait, err := app.loginRetryAfter(ctx, r, "nobody@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wait.Round(time.Second) != testLockout.duration {
+		t.Fatalf("unknown email waits %s, want %s", wait, testLockout.duration)
+	}
+
+	until := time.Now().Add(testLockout.duration)
+	jane.LockedUntil = &until
+
+	wait, err = app.loginRetryAfter(ctx, r, jane.Email, jane)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wait.Round(time.Second) != testLockout.duration {
+		t.Fatalf("locked account waits %s, want %s", wait, testLockout.duration)
+	}
+}
+
+func TestLoginRetryAfterIgnoresCase(t *testing.T) {
+	ctx := context.Background()
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+
+	app, _, _ := newLockoutApp()
+
+	for range testLockout.freeAttempts {
+		if err := app.recordLoginFailure(ctx, r, "password", "Jane@Example.com", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wait, err := app.loginRetryAfter(ctx, r, "jane@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wait <= 0 {
+		t.Fatal("failures for the same email in another case were not counted")
+	}
+}
+
+func TestLoginFailuresCounted(t *testing.T) {
+	tests := []struct {
+		method  string
+		handler func(app *application) http.HandlerFunc
+		body    string
+	}{
+		{"magic_link", func(app *application) http.HandlerFunc { return app.magicLinkTokenHandler }, ""},
+		{"passkey", func(app *application) http.HandlerFunc { return app.passkeyLoginHandler }, `{
+			"id": "AQID", "rawId": "AQID", "type": "public-key",
+			"response": {"clientDataJSON": "` + webauthn.Encode([]byte(`{"type":"webauthn.get","challenge":"abc"}`)) + `",
+				"authenticatorData": "", "signature": "", "userHandle": ""}
+		}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			app, attempts, events := newLockoutApp()
+
+			do := func() int {
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("token", "made-up")
+
+				r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+				r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+				w := httptest.NewRecorder()
+				tt.handler(app)(w, r)
+				return w.Code
+			}
+
+			if code := do(); code != http.StatusUnauthorized {
+				t.Fatalf("got %d, want %d", code, http.StatusUnauthorized)
+			}
+
+			if len(attempts.attempts) != 1 || events.count(store.EventLoginFailed) != 1 {
+				t.Fatalf("failure not counted: %d attempts, %d events", len(attempts.attempts), events.count(store.EventLoginFailed))
+			}
+
+			if method := events.events[0].Metadata["method"]; method != tt.method {
+				t.Fatalf("login.failed recorded for method %v, want %s", method, tt.method)
+			}
+
+			for range testLockout.ipMaxAttempts - 1 {
+				do()
+			}
+
+			if code := do(); code != http.StatusTooManyRequests {
+				t.Fatalf("got %d after %d failures, want %d", code, testLockout.ipMaxAttempts, http.StatusTooManyRequests)
+			}
+		})
+	}
+}
+
+// fakeChallenges keeps mfa challenges in memory.
+type fakeChallenges struct {
+	*store.TwoFactorStore
+
+	mu         sync.Mutex
+	challenges map[string]*store.MFAChallenge
+}
+
+func (f *fakeChallenges) GetChallenge(ctx context.Context, token string) (*store.MFAChallenge, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	challenge, ok := f.challenges[token]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return challenge, nil
+}
+
+func (f *fakeChallenges) ConsumeChallenge(ctx context.Context, token string) (*store.MFAChallenge, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	challenge, ok := f.challenges[token]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	delete(f.challenges, token)
+	return challenge, nil
+}
+
+// fakeMFAUser is the one user, with two-factor authentication on.
+type fakeMFAUser struct {
+	fakeLoginUsers
+
+	user *store.User
+}
+
+func (f fakeMFAUser) GetByID(ctx context.Context, id int64) (*store.User, error) {
+	if id != f.user.ID {
+		return nil, store.ErrNotFound
+	}
+	return f.user, nil
+}
+
+func TestMFAThrottleKeepsChallenge(t *testing.T) {
+	ctx := context.Background()
+	jane := &store.User{ID: 1, Email: "jane@example.com", TOTPEnabled: true}
+
+	app, _, _ := newLockoutApp()
+	app.store.Users = fakeMFAUser{user: jane}
+
+	challenges := &fakeChallenges{challenges: map[string]*store.MFAChallenge{
+		hashToken("mfa-token"): {Token: hashToken("mfa-token"), UserID: jane.ID, ExpiresAt: time.Now().Add(mfaTokenExp)},
+	}}
+	app.store.TwoFactor = challenges
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	for range testLockout.freeAttempts + 1 {
+		if err := app.recordLoginFailure(ctx, r, "two_factor", jane.Email, jane); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"mfa_token": "mfa-token", "code": "123456"}`))
+	w := httptest.NewRecorder()
+	app.createMFATokenHandler(w, r)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("got %d %s, want %d", w.Code, w.Body, http.StatusTooManyRequests)
+	}
+
+	// the client can retry with the same token once the delay is over
+	if len(challenges.challenges) != 1 {
+		t.Fatal("a throttled attempt used up the challenge")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/gratefulness-app/grace/internal/mailer"
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+type MagicLinkPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// requestMagicLinkHandler godoc
+//
+// @Summary Request a magic link
+// @Description Email a one-time sign-in link. Always responds 202 so it can't be used to find out which emails have an account.
+// @Tags authentication
+// @Accept json
+// @Param payload body MagicLinkPayload true "Account email"
+// @Success 202 "Request accepted"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Router /v1/authentication/magic-link [post]
+func (app *application) requestMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MagicLinkPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		ctx := context.Background()
+
+		user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+		if err != nil {
+			if err != store.ErrNotFound {
+				log.Printf("error looking up user for magic link: %s", err.Error())
+			}
+			return
+		}
+
+		// same rule as password login
+		if !user.Verified {
+			return
+		}
+
+		plainToken := uuid.New().String()
+
+		if err := app.store.Users.CreateLoginLink(ctx, user.ID, hashToken(plainToken), app.config.mail.loginLinkExp); err != nil {
+			log.Printf("error creating magic link: %s", err.Error())
+			return
+		}
+
+		vars := struct {
+			Username string
+			LoginURL string
+		}{
+			Username: user.Username,
+			LoginURL: fmt.Sprintf("%s/login/magic/%s", app.config.frontendURL, plainToken),
+		}
+
+		if err := app.mailer.Send(mailer.MagicLinkTemplate, user.Username, user.Email, vars); err != nil {
+			log.Printf("error sending magic link email: %s", err.Error())
+		}
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// magicLinkTokenHandler godoc
+//
+// @Summary Sign in with a magic link
+// @Description Exchange a magic link token for the same tokens as a password login
+// @Tags authentication
+// @Produce json
+// @Param token path string true "Magic link token"
+// @Success 201 {object} TokenResponse "Tokens"
+// @Success 200 {object} MFAChallengeResponse "Second factor required"
+// @Failure 401 {object} ErrorResponse "Token not found, used or expired"
+// @Failure 429 {object} ErrorResponse "Too many failed attempts"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/authentication/magic-link/{token} [post]
+func (app *application) magicLinkTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.throttleLogin(w, r) {
+		return
+	}
+
+	token := chi.URLParam(r, "token")
+	ctx := r.Context()
+
+	userID, err := app.store.Users.ConsumeLoginLink(ctx, hashToken(token))
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			if app.countLoginFailure(w, r, "magic_link") {
+				app.unauthorizedErrorResponse(w, r, err)
+			}
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.store.Users.GetByID(ctx, userID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.completeLogin(w, r, user)
+}
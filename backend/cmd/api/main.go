@@ -1,15 +1,28 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"log"
+	"net/netip"
+	"strings"
 	"time"
+	_ "time/tzdata" // time zones are validated against the IANA database
 
+	"github.com/gratefulness-app/grace/internal/auth"
 	"github.com/gratefulness-app/grace/internal/db"
 	"github.com/gratefulness-app/grace/internal/env"
+	"github.com/gratefulness-app/grace/internal/mailer"
+	"github.com/gratefulness-app/grace/internal/oidc"
 	"github.com/gratefulness-app/grace/internal/store"
+	"github.com/gratefulness-app/grace/internal/webauthn"
 )
 
-const version = "0.0.1"
+const (
+	version              = "0.0.1"
+	minTokenSecretLength = 32
+)
 
 func main() {
 	cfg := config{
@@ -20,12 +33,73 @@ func main() {
 			maxIdleConns: env.GetInt("DB_MAX_IDLE_CONNS", 30),
 			maxIdleTime:  env.GetString("DB_MAX_IDLE_TIME", "15m"),
 		},
-		env: env.GetString("ENV", "development"),
+		env:         env.GetString("ENV", "development"),
+		frontendURL: env.GetString("FRONTEND_URL", "http://localhost:3000"),
+		registration: registrationConfig{
+			inviteOnly:     env.GetBool("INVITE_ONLY", false),
+			inviteExp:      time.Hour * 24 * 14, // 2 weeks
+			maxActiveCodes: env.GetInt("MAX_ACTIVE_INVITE_CODES", 5),
+		},
+		deletion: deletionConfig{
+			gracePeriod:   time.Hour * 24 * time.Duration(env.GetInt("ACCOUNT_DELETION_GRACE_DAYS", 30)),
+			purgeInterval: time.Hour,
+		},
+		export: exportConfig{
+			exp:           time.Hour * 24 * 7, // 1 week
+			timeout:       time.Minute * 30,
+			purgeInterval: time.Hour,
+		},
 		mail: mailConfig{
-			exp: time.Hour * 24 * 3, // 3 days
+			exp:            time.Hour * 24 * 3, // 3 days
+			resetExp:       time.Hour,
+			emailChangeExp: time.Hour * 24,
+			loginLinkExp:   time.Minute * 15,
+			unlockExp:      time.Hour * 24,
+			fromEmail:      env.GetString("FROM_EMAIL", "no-reply@grace.app"),
+			smtp: smtpConfig{
+				host:     env.GetString("SMTP_HOST", ""),
+				port:     env.GetInt("SMTP_PORT", 587),
+				username: env.GetString("SMTP_USERNAME", ""),
+				password: env.GetString("SMTP_PASSWORD", ""),
+			},
+			dir: env.GetString("MAIL_DIR", ""),
+		},
+		auth: authConfig{
+			token: tokenConfig{
+				exp:        time.Minute * 15,
+				refreshExp: time.Hour * 24 * 30, // 30 days
+				iss:        "grace",
+			},
+			webauthn: webauthn.Config{
+				RPID:   env.GetString("WEBAUTHN_RP_ID", "localhost"),
+				RPName: "Grace",
+			},
+			lockout: lockoutConfig{
+				window:        time.Minute * 15,
+				freeAttempts:  3,
+				baseDelay:     time.Second,
+				maxDelay:      time.Minute,
+				maxAttempts:   env.GetInt("LOGIN_MAX_ATTEMPTS", 10),
+				duration:      time.Minute * 30,
+				ipMaxAttempts: env.GetInt("LOGIN_IP_MAX_ATTEMPTS", 50),
+			},
 		},
 	}
 
+	secret, err := tokenSecret(cfg.env)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.auth.token.secret = secret
+
+	cfg.trustedProxies, err = trustedProxies()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg.oidc = oidcConfigs(cfg.frontendURL)
+	cfg.auth.webauthn.Origin = cfg.frontendURL
+
 	db, err := db.New(
 		cfg.db.addr,
 		cfg.db.maxOpenConns,
@@ -41,11 +115,129 @@ func main() {
 
 	store := store.NewStorage(db)
 
+	// Without an SMTP host emails are only logged (and written to MAIL_DIR).
+	var mail mailer.Client
+	if cfg.mail.smtp.host != "" {
+		mail = mailer.NewSMTP(
+			cfg.mail.smtp.host,
+			cfg.mail.smtp.port,
+			cfg.mail.smtp.username,
+			cfg.mail.smtp.password,
+			cfg.mail.fromEmail,
+		)
+	} else {
+		mail = mailer.NewLog(cfg.mail.dir)
+	}
+
+	jwtAuthenticator := auth.NewJWTAuthenticator(
+		cfg.auth.token.secret,
+		cfg.auth.token.iss,
+		cfg.auth.token.iss,
+	)
+
+	oidcProviders := make(map[string]*oidc.Provider, len(cfg.oidc))
+	for _, c := range cfg.oidc {
+		oidcProviders[c.Name] = oidc.NewProvider(c)
+	}
+
 	app := &application{
-		config: cfg,
-		store:  store,
+		config:        cfg,
+		store:         store,
+		mailer:        mail,
+		authenticator: jwtAuthenticator,
+		oidcProviders: oidcProviders,
+		webauthn:      webauthn.New(cfg.auth.webauthn),
 	}
 
+	app.every(cfg.deletion.purgeInterval, app.purgeDeletedAccounts)
+	app.every(cfg.export.purgeInterval, app.purgeExpiredExports)
+
 	mux := app.mount()
 	log.Fatal(app.run(mux))
 }
+
+// tokenSecret reads the key access tokens are signed with from
+// AUTH_TOKEN_SECRET. Outside of development a missing or short secret is an
+// error. In development a random one is generated instead, so tokens don't
+// survive a restart.
+func tokenSecret(environment string) (string, error) {
+	secret := env.GetString("AUTH_TOKEN_SECRET", "")
+	if len(secret) >= minTokenSecretLength {
+		return secret, nil
+	}
+
+	if environment != "development" {
+		return "", fmt.Errorf("AUTH_TOKEN_SECRET must be at least %d characters long", minTokenSecretLength)
+	}
+
+	if secret != "" {
+		log.Printf("AUTH_TOKEN_SECRET is shorter than %d characters, only do this in development", minTokenSecretLength)
+		return secret, nil
+	}
+
+	b := make([]byte, minTokenSecretLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	log.Println("AUTH_TOKEN_SECRET is not set, signing tokens with a random secret")
+
+	return hex.EncodeToString(b), nil
+}
+
+// trustedProxies reads the addresses of the reverse proxies in front of the
+// API from TRUSTED_PROXIES, a comma-separated list of IPs and CIDR ranges (e.g.
+// "10.0.0.0/8,192.168.1.5"). Without it forwarded headers are ignored.
+func trustedProxies() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, s := range strings.Split(env.GetString("TRUSTED_PROXIES", ""), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		if !strings.Contains(s, "/") {
+			ip, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// oidcConfigs reads the OpenID Connect providers listed in OIDC_PROVIDERS
+// (e.g. "google,github"). Each provider is configured with
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET.
+func oidcConfigs(frontendURL string) []oidc.Config {
+	var configs []oidc.Config
+
+	for _, name := range strings.Split(env.GetString("OIDC_PROVIDERS", ""), ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		configs = append(configs, oidc.Config{
+			Name:         name,
+			Issuer:       env.GetString(prefix+"ISSUER", ""),
+			ClientID:     env.GetString(prefix+"CLIENT_ID", ""),
+			ClientSecret: env.GetString(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  fmt.Sprintf("%s/login/oidc/%s", frontendURL, name),
+		})
+	}
+
+	return configs
+}
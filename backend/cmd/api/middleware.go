@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+type authUserKey string
+
+const (
+	authUserCtx authUserKey = "authUser"
+	sessionCtx  authUserKey = "session"
+)
+
+// AuthTokenMiddleware validates the bearer access token and puts the
+// authenticated user in the request context.
+func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			app.unauthorizedErrorResponse(w, r, errors.New("authorization header is missing"))
+			return
+		}
+
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			app.unauthorizedErrorResponse(w, r, errors.New("authorization header is malformed"))
+			return
+		}
+
+		claims, err := app.authenticator.ValidateToken(parts[1])
+		if err != nil {
+			app.unauthorizedErrorResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		// the session may have been revoked since the access token was issued
+		if err := app.store.UserTokens.Touch(ctx, claims.Sid, claims.Sub); err != nil {
+			switch err {
+			case store.ErrNotFound:
+				app.unauthorizedErrorResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		user, err := app.store.Users.GetByID(ctx, claims.Sub)
+		if err != nil {
+			switch err {
+			case store.ErrNotFound:
+				app.unauthorizedErrorResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		if err := inactiveAccountErr(user); err != nil {
+			app.forbiddenResponse(w, r, err)
+			return
+		}
+
+		ctx = context.WithValue(ctx, authUserCtx, user)
+		ctx = context.WithValue(ctx, sessionCtx, claims.Sid)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RealIPMiddleware replaces RemoteAddr with the client's address forwarded by
+// one of the trusted proxies. X-Forwarded-For is read from the right, skipping
+// the proxies' own addresses; X-Real-IP is used when it's missing. Headers
+// sent by anyone else are ignored, so clients can't pick the IP address their
+// failed logins are counted under.
+func (app *application) RealIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip, ok := forwardedIP(r, app.config.trustedProxies); ok {
+			r.RemoteAddr = ip.String()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func forwardedIP(r *http.Request, trusted []netip.Prefix) (netip.Addr, bool) {
+	isTrusted := func(ip netip.Addr) bool {
+		for _, prefix := range trusted {
+			if prefix.Contains(ip.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	peer, err := netip.ParseAddr(clientIP(r))
+	if err != nil || !isTrusted(peer) {
+		return netip.Addr{}, false
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				return netip.Addr{}, false
+			}
+			if !isTrusted(ip) {
+				return ip.Unmap(), true
+			}
+		}
+		return netip.Addr{}, false
+	}
+
+	ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+func getAuthUserFromCtx(r *http.Request) *store.User {
+	user, _ := r.Context().Value(authUserCtx).(*store.User)
+	return user
+}
+
+func getSessionIDFromCtx(r *http.Request) int64 {
+	id, _ := r.Context().Value(sessionCtx).(int64)
+	return id
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestRealIPMiddleware(t *testing.T) {
+	app := &application{}
+	app.config.trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		xRealIP    string
+		want       string
+	}{
+		{"direct", "203.0.113.7:1234", "", "", "203.0.113.7:1234"},
+		{"spoofed forwarded for", "203.0.113.7:1234", "198.51.100.1", "", "203.0.113.7:1234"},
+		{"spoofed real ip", "203.0.113.7:1234", "", "198.51.100.1", "203.0.113.7:1234"},
+		{"trusted proxy", "10.0.0.1:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"trusted proxy real ip", "10.0.0.1:1234", "", "198.51.100.1", "198.51.100.1"},
+		// the client can prepend whatever it likes, only the hop the proxy added counts
+		{"spoofed hop", "10.0.0.1:1234", "192.0.2.1, 198.51.100.1", "", "198.51.100.1"},
+		{"proxy chain", "10.0.0.1:1234", "198.51.100.1, 10.0.0.2", "", "198.51.100.1"},
+		{"only proxies", "10.0.0.1:1234", "10.0.0.2", "", "10.0.0.1:1234"},
+		{"garbage", "10.0.0.1:1234", "not an ip", "", "10.0.0.1:1234"},
+		{"no header", "10.0.0.1:1234", "", "", "10.0.0.1:1234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.xRealIP != "" {
+				r.Header.Set("X-Real-IP", tt.xRealIP)
+			}
+
+			var got string
+			app.RealIPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			})).ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+var errAccountSuspended = errors.New("this account has been suspended")
+
+// suspendUserHandler godoc
+//
+// @Summary Suspend a user
+// @Description Lock a user out and revoke all of their sessions
+// @Tags moderation
+// @Param userID path int true "User ID"
+// @Success 204 "User suspended"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/{userID}/suspension [put]
+func (app *application) suspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	if err := app.store.Users.Suspend(r.Context(), user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, store.EventSuspended, user.ID, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unsuspendUserHandler godoc
+//
+// @Summary Lift a user's suspension
+// @Tags moderation
+// @Param userID path int true "User ID"
+// @Success 204 "Suspension lifted"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/{userID}/suspension [delete]
+func (app *application) unsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	if err := app.store.Users.Unsuspend(r.Context(), user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, store.EventUnsuspended, user.ID, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type UpdateRolePayload struct {
+	Role string `json:"role" validate:"required,oneof=user moderator"`
+}
+
+// updateUserRoleHandler godoc
+//
+// @Summary Change a user's role
+// @Description Promote a user to moderator or demote them back. Admins are only granted in the database.
+// @Tags moderation
+// @Accept json
+// @Param userID path int true "User ID"
+// @Param payload body UpdateRolePayload true "New role"
+// @Success 204 "Role changed"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/{userID}/role [put]
+func (app *application) updateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	var payload UpdateRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	role, err := app.store.Roles.GetByName(ctx, payload.Role)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Users.UpdateRole(ctx, user.ID, role.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, store.EventRoleChanged, user.ID, map[string]any{"from": user.Role.Name, "to": role.Name})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteCardHandler godoc
+//
+// @Summary Remove a card
+// @Description Take down a card that breaks the community guidelines
+// @Tags moderation
+// @Param cardID path int true "Card ID"
+// @Success 204 "Card removed"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Card not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/cards/{cardID} [delete]
+func (app *application) deleteCardHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "cardID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Cards.Delete(r.Context(), id); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/gratefulness-app/grace/internal/oidc"
+	"github.com/gratefulness-app/grace/internal/store"
+	"github.com/gratefulness-app/grace/internal/usernames"
+)
+
+const oidcStateExp = time.Minute * 10
+
+var (
+	errUnknownProvider     = errors.New("unknown identity provider")
+	errInvalidOIDCState    = errors.New("invalid or expired login attempt")
+	errOIDCEmailRequired   = errors.New("the identity provider did not share an email address")
+	errOIDCEmailUnverified = errors.New("the identity provider has not verified your email address")
+	errAccountExists       = errors.New("an account with this email already exists, sign in and link the provider from your settings")
+	errLastSignInMethod    = errors.New("this is your only way to sign in, verify your email before unlinking it")
+)
+
+type OIDCCallbackPayload struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+type AuthorizationURLResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// startOIDCLoginHandler godoc
+//
+// @Summary Start an OpenID Connect login
+// @Description Returns the provider URL to send the user to. The provider redirects back to the frontend, which completes the login with the callback endpoint.
+// @Tags authentication
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} AuthorizationURLResponse "Authorization URL"
+// @Failure 404 {object} ErrorResponse "Unknown provider"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/authentication/oidc/{provider} [post]
+func (app *application) startOIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	app.beginOIDC(w, r, nil)
+}
+
+// oidcCallbackHandler godoc
+//
+// @Summary Complete an OpenID Connect login
+// @Description Redeem the code and state the provider redirected with. Logs in, creating the account on first sign-in if the provider verified the email. Flows started to link a provider have to be completed with the identities callback instead.
+// @Tags authentication
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param payload body OIDCCallbackPayload true "Code and state"
+// @Success 201 {object} TokenResponse "Tokens"
+// @Success 200 {object} MFAChallengeResponse "Second factor required"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Unknown provider"
+// @Failure 409 {object} ErrorResponse "Account or identity already exists"
+// @Failure 429 {object} ErrorResponse "Too many failed attempts"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/authentication/oidc/{provider}/callback [post]
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.throttleLogin(w, r) {
+		return
+	}
+
+	provider, claims, ok := app.redeemOIDC(w, r, nil)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	identity := &store.Identity{
+		Provider: provider.Name(),
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	existing, err := app.store.Identities.GetBySubject(ctx, provider.Name(), claims.Subject)
+	switch err {
+	case nil:
+		user, err := app.store.Users.GetByID(ctx, existing.UserID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !user.Verified {
+			app.unauthorizedErrorResponse(w, r, errUserNotVerified)
+			return
+		}
+
+		app.completeLogin(w, r, user)
+		return
+	case store.ErrNotFound:
+	default:
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// first sign in with this provider: create an account, which needs an
+	// invite code while registration is invite-only
+	if app.config.registration.inviteOnly {
+		app.forbiddenResponse(w, r, errInviteRequired)
+		return
+	}
+
+	if claims.Email == "" {
+		app.badRequestResponse(w, r, errOIDCEmailRequired)
+		return
+	}
+
+	// the session is for whoever owns the address, the provider has to vouch
+	// for that
+	if !claims.EmailVerified {
+		app.badRequestResponse(w, r, errOIDCEmailUnverified)
+		return
+	}
+
+	// never link to an existing account implicitly, the provider's word on
+	// the email is not proof the person owns the Grace account
+	_, err = app.store.Users.GetByEmail(ctx, claims.Email)
+	switch err {
+	case nil:
+		app.conflictResponse(w, r, errAccountExists)
+		return
+	case store.ErrNotFound:
+	default:
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	user := &store.User{
+		Username: oidcUsername(claims),
+		Email:    claims.Email,
+		Verified: true,
+	}
+
+	// the account has no usable password until the user sets one through a
+	// password reset
+	if err := user.Password.Set(uuid.New().String()); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Users.CreateWithIdentity(ctx, user, identity); err != nil {
+		switch err {
+		case store.ErrDuplicateEmail, store.ErrDuplicateUsername, store.ErrDuplicateIdentity:
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, store.EventRegistered, user.ID, map[string]any{"method": provider.Name()})
+
+	app.completeLogin(w, r, user)
+}
+
+// listIdentitiesHandler godoc
+//
+// @Summary List linked identities
+// @Tags me
+// @Produce json
+// @Success 200 {array} store.Identity "Identities"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/identities [get]
+func (app *application) listIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	identities, err := app.store.Identities.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, identities); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// linkIdentityHandler godoc
+//
+// @Summary Start linking a provider
+// @Description Returns the provider URL to send the user to. The identities callback endpoint, called from the same session, links the identity to the authenticated user.
+// @Tags me
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} AuthorizationURLResponse "Authorization URL"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Unknown provider"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/identities/{provider} [post]
+func (app *application) linkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	app.beginOIDC(w, r, &store.OIDCState{
+		UserID:    getAuthUserFromCtx(r).ID,
+		SessionID: getSessionIDFromCtx(r),
+	})
+}
+
+// linkIdentityCallbackHandler godoc
+//
+// @Summary Complete linking a provider
+// @Description Redeem the code and state the provider redirected with and link the identity to the authenticated user. Only the session that started linking can complete it.
+// @Tags me
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param payload body OIDCCallbackPayload true "Code and state"
+// @Success 201 {object} store.Identity "Linked identity"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Unknown provider"
+// @Failure 409 {object} ErrorResponse "Identity already linked"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/identities/{provider}/callback [post]
+func (app *application) linkIdentityCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	provider, claims, ok := app.redeemOIDC(w, r, &store.OIDCState{
+		UserID:    user.ID,
+		SessionID: getSessionIDFromCtx(r),
+	})
+	if !ok {
+		return
+	}
+
+	identity := &store.Identity{
+		UserID:   user.ID,
+		Provider: provider.Name(),
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	if err := app.store.Identities.Link(r.Context(), identity); err != nil {
+		switch err {
+		case store.ErrDuplicateIdentity:
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, identity); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// unlinkIdentityHandler godoc
+//
+// @Summary Unlink a provider
+// @Description Unlink an identity. Refused when it is the user's only way to sign in.
+// @Tags me
+// @Param identityID path int true "Identity ID"
+// @Success 204 "Identity unlinked"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Identity not found"
+// @Failure 409 {object} ErrorResponse "Only sign-in method"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/identities/{identityID} [delete]
+func (app *application) unlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "identityID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	identities, err := app.store.Identities.GetByUserID(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// without a verified email there is no password reset or magic link to
+	// fall back on once the last identity is gone
+	if len(identities) == 1 && !user.Verified {
+		app.conflictResponse(w, r, errLastSignInMethod)
+		return
+	}
+
+	if err := app.store.Identities.Delete(ctx, id, user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// beginOIDC stores a new authorization request and responds with the URL of
+// the provider. owner is nil for a login and holds the user and session when
+// an authenticated user links a provider.
+func (app *application) beginOIDC(w http.ResponseWriter, r *http.Request, owner *store.OIDCState) {
+	provider, ok := app.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		app.notFoundResponse(w, r, errUnknownProvider)
+		return
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		s, err := oidc.RandomString()
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		secrets[i] = s
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	if owner == nil {
+		owner = &store.OIDCState{}
+	}
+
+	ctx := r.Context()
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	err = app.store.Identities.CreateState(ctx, &store.OIDCState{
+		State:        hashToken(state),
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserID:       owner.UserID,
+		SessionID:    owner.SessionID,
+		ExpiresAt:    time.Now().Add(oidcStateExp),
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, AuthorizationURLResponse{authURL}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// redeemOIDC consumes the state of a callback and exchanges the code for the
+// claims of the ID token. owner must match whoever started the flow: nil for
+// a login, the user and session for a link. Anything else is rejected before
+// the code is redeemed. It has responded when ok is false.
+func (app *application) redeemOIDC(w http.ResponseWriter, r *http.Request, owner *store.OIDCState) (*oidc.Provider, *oidc.Claims, bool) {
+	provider, ok := app.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		app.notFoundResponse(w, r, errUnknownProvider)
+		return nil, nil, false
+	}
+
+	var payload OIDCCallbackPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, nil, false
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, nil, false
+	}
+
+	ctx := r.Context()
+
+	// failed logins count against the IP address, failed links don't as the
+	// user is signed in already
+	login := owner == nil
+	if login {
+		owner = &store.OIDCState{}
+	}
+
+	state, err := app.store.Identities.ConsumeState(ctx, hashToken(payload.State), provider.Name())
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			if !login || app.countLoginFailure(w, r, provider.Name()) {
+				app.badRequestResponse(w, r, errInvalidOIDCState)
+			}
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	// a link must not be finished anywhere but the session that started it,
+	// or a victim could be tricked into linking the attacker's identity
+	if state.UserID != owner.UserID || state.SessionID != owner.SessionID {
+		if !login || app.countLoginFailure(w, r, provider.Name()) {
+			app.badRequestResponse(w, r, errInvalidOIDCState)
+		}
+		return nil, nil, false
+	}
+
+	claims, err := provider.Exchange(ctx, payload.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		if !login || app.countLoginFailure(w, r, provider.Name()) {
+			app.unauthorizedErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	return provider, claims, true
+}
+
+// oidcUsername derives a username for a new account from the provider's
+// profile, with a random suffix to keep it unique.
+func oidcUsername(claims *oidc.Claims) string {
+	base := claims.Name
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	// leave room for the suffix within usernames.MaxLength
+	base = usernames.Sanitize(base, usernames.MaxLength-7)
+	if base == "" || usernames.IsReserved(base) {
+		base = "user"
+	}
+
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+
+	return base + "_" + hex.EncodeToString(suffix)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gratefulness-app/grace/internal/oidc"
+	"github.com/gratefulness-app/grace/internal/oidc/oidctest"
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+// fakeIdentities keeps states and identities in memory. Methods the OIDC
+// handlers don't call fall through to the nil IdentityStore.
+type fakeIdentities struct {
+	*store.IdentityStore
+
+	mu         sync.Mutex
+	states     map[string]*store.OIDCState
+	identities []*store.Identity
+}
+
+func (f *fakeIdentities) CreateState(ctx context.Context, state *store.OIDCState) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := *state
+	f.states[state.State] = &s
+	return nil
+}
+
+func (f *fakeIdentities) ConsumeState(ctx context.Context, hash, provider string) (*store.OIDCState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	state, ok := f.states[hash]
+	if !ok || state.Provider != provider {
+		return nil, store.ErrNotFound
+	}
+
+	delete(f.states, hash)
+	return state, nil
+}
+
+func (f *fakeIdentities) Link(ctx context.Context, identity *store.Identity) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, i := range f.identities {
+		if i.Provider == identity.Provider && i.Subject == identity.Subject {
+			return store.ErrDuplicateIdentity
+		}
+	}
+
+	identity.ID = int64(len(f.identities) + 1)
+	f.identities = append(f.identities, identity)
+	return nil
+}
+
+func (f *fakeIdentities) GetBySubject(ctx context.Context, provider, subject string) (*store.Identity, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, i := range f.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return i, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+type oidcTest struct {
+	app        *application
+	server     *oidctest.Server
+	identities *fakeIdentities
+	attempts   *fakeLoginAttempts
+	events     *fakeSecurityEvents
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+
+	server := oidctest.NewServer(t)
+	identities := &fakeIdentities{states: make(map[string]*store.OIDCState)}
+
+	app, attempts, events := newLockoutApp()
+	app.store.Identities = identities
+	app.oidcProviders = map[string]*oidc.Provider{"test": oidc.NewProvider(server.Config("test"))}
+
+	return &oidcTest{
+		app:        app,
+		server:     server,
+		identities: identities,
+		attempts:   attempts,
+		events:     events,
+	}
+}
+
+// do calls handler as the user and session, or anonymously when user is nil.
+func (tt *oidcTest) do(t *testing.T, handler http.HandlerFunc, user *store.User, sessionID int64, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("provider", "test")
+
+	ctx := context.WithValue(context.Background(), chi.RouteCtxKey, rctx)
+	if user != nil {
+		ctx = context.WithValue(ctx, authUserCtx, user)
+		ctx = context.WithValue(ctx, sessionCtx, sessionID)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", &buf).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	handler(w, r)
+
+	return w
+}
+
+// start begins a flow through handler and signs in to the provider with the
+// identity, returning the callback payload the frontend would send.
+func (tt *oidcTest) start(t *testing.T, handler http.HandlerFunc, user *store.User, sessionID int64, identity oidctest.Identity) OIDCCallbackPayload {
+	t.Helper()
+
+	w := tt.do(t, handler, user, sessionID, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("start: got %d %s", w.Code, w.Body)
+	}
+
+	var res struct {
+		Data AuthorizationURLResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := tt.server.Authorize(t, res.Data.AuthorizationURL, identity)
+
+	return OIDCCallbackPayload{Code: code, State: state}
+}
+
+var attacker = oidctest.Identity{
+	Subject:       "attacker",
+	Email:         "mallory@example.com",
+	EmailVerified: true,
+}
+
+func TestLinkIdentity(t *testing.T) {
+	jane := &store.User{ID: 1}
+	john := &store.User{ID: 2}
+
+	tests := []struct {
+		name string
+		// user and session completing the flow started by jane on session 10
+		callback  func(app *application) http.HandlerFunc
+		user      *store.User
+		sessionID int64
+		status    int
+	}{
+		{"same session", linkCallback, jane, 10, http.StatusCreated},
+		{"other session", linkCallback, jane, 11, http.StatusBadRequest},
+		{"other user", linkCallback, john, 10, http.StatusBadRequest},
+		{"login callback", loginCallback, nil, 0, http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tt := newOIDCTest(t)
+
+			payload := tt.start(t, tt.app.linkIdentityHandler, jane, 10, attacker)
+
+			w := tt.do(t, tc.callback(tt.app), tc.user, tc.sessionID, payload)
+			if w.Code != tc.status {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body, tc.status)
+			}
+
+			linked := len(tt.identities.identities)
+			if tc.status == http.StatusCreated {
+				if linked != 1 || tt.identities.identities[0].UserID != jane.ID {
+					t.Fatalf("identity not linked to the user: %+v", tt.identities.identities)
+				}
+			} else if linked != 0 {
+				t.Fatalf("identity was linked: %+v", tt.identities.identities)
+			}
+
+			// the state is gone either way, a second try can't succeed
+			if w := tt.do(t, linkCallback(tt.app), jane, 10, payload); w.Code != http.StatusBadRequest {
+				t.Fatalf("state reused: got %d %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	jane := &store.User{ID: 1}
+
+	t.Run("unknown state", func(t *testing.T) {
+		tt := newOIDCTest(t)
+
+		payload := tt.start(t, tt.app.startOIDCLoginHandler, nil, 0, attacker)
+		payload.State = "made-up"
+
+		if w := tt.do(t, tt.app.oidcCallbackHandler, nil, 0, payload); w.Code != http.StatusBadRequest {
+			t.Fatalf("got %d %s", w.Code, w.Body)
+		}
+
+		if len(tt.attempts.attempts) != 1 {
+			t.Fatalf("failed login counted %d times, want 1", len(tt.attempts.attempts))
+		}
+
+		if n := tt.events.count(store.EventLoginFailed); n != 1 {
+			t.Fatalf("login.failed recorded %d times, want 1", n)
+		}
+	})
+
+	t.Run("login state at the link callback", func(t *testing.T) {
+		tt := newOIDCTest(t)
+
+		payload := tt.start(t, tt.app.startOIDCLoginHandler, nil, 0, attacker)
+
+		if w := tt.do(t, tt.app.linkIdentityCallbackHandler, jane, 10, payload); w.Code != http.StatusBadRequest {
+			t.Fatalf("got %d %s", w.Code, w.Body)
+		}
+
+		if len(tt.identities.identities) != 0 {
+			t.Fatal("identity was linked")
+		}
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		tt := newOIDCTest(t)
+		tt.server.TamperIDToken = func(c map[string]any) { c["nonce"] = "replayed" }
+
+		payload := tt.start(t, tt.app.linkIdentityHandler, jane, 10, attacker)
+
+		if w := tt.do(t, tt.app.linkIdentityCallbackHandler, jane, 10, payload); w.Code != http.StatusUnauthorized {
+			t.Fatalf("got %d %s", w.Code, w.Body)
+		}
+
+		if len(tt.identities.identities) != 0 {
+			t.Fatal("identity was linked")
+		}
+
+		// failed links aren't failed logins
+		if len(tt.attempts.attempts) != 0 {
+			t.Fatal("failed link counted as a failed login")
+		}
+	})
+
+	t.Run("unverified email", func(t *testing.T) {
+		tt := newOIDCTest(t)
+
+		identity := attacker
+		identity.EmailVerified = false
+
+		payload := tt.start(t, tt.app.startOIDCLoginHandler, nil, 0, identity)
+
+		// the user store has no database, creating an account would panic
+		if w := tt.do(t, tt.app.oidcCallbackHandler, nil, 0, payload); w.Code != http.StatusBadRequest {
+			t.Fatalf("got %d %s", w.Code, w.Body)
+		}
+	})
+}
+
+func linkCallback(app *application) http.HandlerFunc  { return app.linkIdentityCallbackHandler }
+func loginCallback(app *application) http.HandlerFunc { return app.oidcCallbackHandler }
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gratefulness-app/grace/internal/store"
+	"github.com/gratefulness-app/grace/internal/webauthn"
+)
+
+var errInvalidPasskey = errors.New("invalid or expired passkey ceremony")
+
+type RegisterPasskeyPayload struct {
+	Name       string                        `json:"name" validate:"required,max=100"`
+	Credential webauthn.RegistrationResponse `json:"credential"`
+}
+
+// beginPasskeyRegistrationHandler godoc
+//
+// @Summary Start registering a passkey
+// @Description Returns the options to pass to navigator.credentials.create()
+// @Tags me
+// @Produce json
+// @Success 200 {object} webauthn.CreationOptions "Creation options"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/passkeys/register [post]
+func (app *application) beginPasskeyRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+	ctx := r.Context()
+
+	passkeys, err := app.store.Passkeys.GetByUserID(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	existing := make([][]byte, len(passkeys))
+	for i, passkey := range passkeys {
+		existing[i] = passkey.CredentialID
+	}
+
+	challenge, err := app.createWebAuthnChallenge(r, store.ChallengeRegistration, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	options := app.webauthn.CreationOptions(challenge, user.ID, user.Username, existing)
+
+	if err := app.jsonResponse(w, http.StatusOK, options); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// registerPasskeyHandler godoc
+//
+// @Summary Register a passkey
+// @Description Verify the authenticator's response and store the new passkey
+// @Tags me
+// @Accept json
+// @Produce json
+// @Param payload body RegisterPasskeyPayload true "Friendly name and credential"
+// @Success 201 {object} store.Passkey "Passkey"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 409 {object} ErrorResponse "Passkey already registered"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/passkeys [post]
+func (app *application) registerPasskeyHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	var payload RegisterPasskeyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	challenge, err := webauthn.ChallengeOf(payload.Credential.Response.ClientDataJSON)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	pending, err := app.store.Passkeys.ConsumeChallenge(ctx, hashToken(challenge), store.ChallengeRegistration)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.badRequestResponse(w, r, errInvalidPasskey)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if pending.UserID != user.ID {
+		app.badRequestResponse(w, r, errInvalidPasskey)
+		return
+	}
+
+	credential, err := app.webauthn.VerifyRegistration(&payload.Credential, challenge)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	passkey := &store.Passkey{
+		UserID:       user.ID,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    credential.SignCount,
+		Name:         payload.Name,
+	}
+
+	if err := app.store.Passkeys.Register(ctx, passkey); err != nil {
+		switch err {
+		case store.ErrDuplicatePasskey:
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, passkey); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// listPasskeysHandler godoc
+//
+// @Summary List passkeys
+// @Tags me
+// @Produce json
+// @Success 200 {array} store.Passkey "Passkeys"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/passkeys [get]
+func (app *application) listPasskeysHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	passkeys, err := app.store.Passkeys.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, passkeys); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deletePasskeyHandler godoc
+//
+// @Summary Remove a passkey
+// @Tags me
+// @Param passkeyID path int true "Passkey ID"
+// @Success 204 "Passkey removed"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Passkey not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/passkeys/{passkeyID} [delete]
+func (app *application) deletePasskeyHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "passkeyID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Passkeys.Delete(r.Context(), id, user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// beginPasskeyLoginHandler godoc
+//
+// @Summary Start a passkey sign-in
+// @Description Returns the options to pass to navigator.credentials.get()
+// @Tags authentication
+// @Produce json
+// @Success 200 {object} webauthn.RequestOptions "Request options"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/authentication/passkey/begin [post]
+func (app *application) beginPasskeyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	challenge, err := app.createWebAuthnChallenge(r, store.ChallengeAuthentication, 0)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, app.webauthn.RequestOptions(challenge)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// passkeyLoginHandler godoc
+//
+// @Summary Sign in with a passkey
+// @Description Verify the authenticator's assertion. A user verified assertion counts as two factors; otherwise 2FA still applies.
+// @Tags authentication
+// @Accept json
+// @Produce json
+// @Param payload body webauthn.AssertionResponse true "Assertion"
+// @Success 201 {object} TokenResponse "Tokens"
+// @Success 200 {object} MFAChallengeResponse "Second factor required"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 429 {object} ErrorResponse "Too many failed attempts"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/authentication/passkey [post]
+func (app *application) passkeyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var payload webauthn.AssertionResponse
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !app.throttleLogin(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+
+	challenge, err := webauthn.ChallengeOf(payload.Response.ClientDataJSON)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if _, err := app.store.Passkeys.ConsumeChallenge(ctx, hashToken(challenge), store.ChallengeAuthentication); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			if app.countLoginFailure(w, r, "passkey") {
+				app.unauthorizedErrorResponse(w, r, errInvalidPasskey)
+			}
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	credentialID, err := webauthn.Decode(payload.RawID)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	passkey, err := app.store.Passkeys.GetByCredentialID(ctx, credentialID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			if app.countLoginFailure(w, r, "passkey") {
+				app.unauthorizedErrorResponse(w, r, err)
+			}
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// discoverable credentials tell us who they belong to, it must agree
+	if payload.Response.UserHandle != "" {
+		handle, err := webauthn.Decode(payload.Response.UserHandle)
+		if err != nil || !bytes.Equal(handle, webauthn.UserHandle(passkey.UserID)) {
+			if app.countLoginFailure(w, r, "passkey") {
+				app.unauthorizedErrorResponse(w, r, errInvalidPasskey)
+			}
+			return
+		}
+	}
+
+	assertion, err := app.webauthn.VerifyAssertion(&payload, challenge, passkey.PublicKey, passkey.SignCount)
+	if err != nil {
+		if app.countLoginFailure(w, r, "passkey") {
+			app.unauthorizedErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Passkeys.UpdateSignCount(ctx, passkey.ID, assertion.SignCount); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	user, err := app.store.Users.GetByID(ctx, passkey.UserID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !assertion.UserVerified {
+		app.completeLogin(w, r, user)
+		return
+	}
+
+	if err := inactiveAccountErr(user); err != nil {
+		app.forbiddenResponse(w, r, err)
+		return
+	}
+
+	refreshToken, session, err := app.createSession(r, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.writeTokens(w, r, session, refreshToken)
+}
+
+func (app *application) createWebAuthnChallenge(r *http.Request, typ string, userID int64) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	err = app.store.Passkeys.CreateChallenge(r.Context(), &store.WebAuthnChallenge{
+		Challenge: hashToken(challenge),
+		Type:      typ,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(webauthn.Timeout),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/gratefulness-app/grace/internal/mailer"
+	"github.com/gratefulness-app/grace/internal/passwords"
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+var errIncorrectPassword = errors.New("current password is incorrect")
+
+type ChangePasswordPayload struct {
+	CurrentPassword     string `json:"current_password" validate:"required"`
+	NewPassword         string `json:"new_password" validate:"required,min=6,max=256"`
+	RevokeOtherSessions bool   `json:"revoke_other_sessions"`
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type ResetPasswordPayload struct {
+	Password string `json:"password" validate:"required,min=6,max=256"`
+}
+
+// forgotPasswordHandler godoc
+//
+// @Summary Request a password reset
+// @Description Email a password reset link. Always responds 202 so it can't be used to find out which emails have an account.
+// @Tags authentication
+// @Accept json
+// @Param payload body ForgotPasswordPayload true "Account email"
+// @Success 202 "Request accepted"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Router /v1/authentication/password-reset [post]
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// do the work in the background so the response time doesn't tell
+	// whether the account exists
+	app.background(func() {
+		ctx := context.Background()
+
+		user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+		if err != nil {
+			if err != store.ErrNotFound {
+				log.Printf("error looking up user for password reset: %s", err.Error())
+			}
+			return
+		}
+
+		plainToken := uuid.New().String()
+
+		if err := app.store.Users.CreatePasswordReset(ctx, user.ID, hashToken(plainToken), app.config.mail.resetExp); err != nil {
+			log.Printf("error creating password reset: %s", err.Error())
+			return
+		}
+
+		vars := struct {
+			Username string
+			ResetURL string
+		}{
+			Username: user.Username,
+			ResetURL: fmt.Sprintf("%s/reset-password/%s", app.config.frontendURL, plainToken),
+		}
+
+		if err := app.mailer.Send(mailer.PasswordResetTemplate, user.Username, user.Email, vars); err != nil {
+			log.Printf("error sending password reset email: %s", err.Error())
+		}
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// resetPasswordHandler godoc
+//
+// @Summary Reset a password
+// @Description Set a new password with a password reset token. Every session of the user is revoked.
+// @Tags authentication
+// @Accept json
+// @Param token path string true "Password reset token"
+// @Param payload body ResetPasswordPayload true "New password"
+// @Success 204 "Password reset"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "Token not found or expired"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/authentication/password-reset/{token} [put]
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	var payload ResetPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, err := app.store.Users.GetByPasswordReset(ctx, hashToken(token))
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := passwords.Check(payload.Password, user.Username, user.Email); err != nil {
+		app.failedValidationResponse(w, r, "password", err)
+		return
+	}
+
+	if err := user.Password.Set(payload.Password); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Users.ResetPassword(ctx, hashToken(token), user); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, store.EventPasswordReset, user.ID, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// changePasswordHandler godoc
+//
+// @Summary Change password
+// @Description Change the authenticated user's password, optionally logging out every other session
+// @Tags me
+// @Accept json
+// @Param payload body ChangePasswordPayload true "Current and new password"
+// @Success 204 "Password changed"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/password [put]
+func (app *application) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	var payload ChangePasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := user.Password.Compare(payload.CurrentPassword); err != nil {
+		app.badRequestResponse(w, r, errIncorrectPassword)
+		return
+	}
+
+	if err := passwords.Check(payload.NewPassword, user.Username, user.Email); err != nil {
+		app.failedValidationResponse(w, r, "new_password", err)
+		return
+	}
+
+	if err := user.Password.Set(payload.NewPassword); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.Users.UpdatePassword(ctx, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if payload.RevokeOtherSessions {
+		err := app.store.UserTokens.DeleteOthersByUserID(ctx, user.ID, getSessionIDFromCtx(r))
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	app.audit(r, store.EventPasswordChanged, user.ID, map[string]any{"revoked_other_sessions": payload.RevokeOtherSessions})
+
+	w.WriteHeader(http.StatusNoContent)
+}
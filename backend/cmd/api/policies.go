@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+var errForbidden = errors.New("you are not allowed to access this resource")
+
+// policy reports whether the authenticated user may act on the resource the
+// request targets. Resources are expected to already be loaded into the
+// request context by their own context middleware.
+type policy func(authUser *store.User, r *http.Request) bool
+
+// authorize guards a route with a policy. It must run after
+// AuthTokenMiddleware and the resource's context middleware.
+func (app *application) authorize(p policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authUser := getAuthUserFromCtx(r)
+			if authUser == nil {
+				app.unauthorizedErrorResponse(w, r, errors.New("missing authenticated user"))
+				return
+			}
+
+			if !p(authUser, r) {
+				app.forbiddenResponse(w, r, errForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireRole only lets users whose role is at least as privileged as the
+// named one through. It must run after AuthTokenMiddleware.
+func (app *application) requireRole(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authUser := getAuthUserFromCtx(r)
+			if authUser == nil {
+				app.unauthorizedErrorResponse(w, r, errors.New("missing authenticated user"))
+				return
+			}
+
+			role, err := app.store.Roles.GetByName(r.Context(), name)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+
+			if authUser.Role.Level < role.Level {
+				app.forbiddenResponse(w, r, errForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ownerPolicy allows the user that owns the resource. ownerID extracts the
+// owner's user id from the resource in the request context, so the same
+// policy serves users, cards, notifications and anything else with a user_id.
+func ownerPolicy(ownerID func(r *http.Request) (int64, bool)) policy {
+	return func(authUser *store.User, r *http.Request) bool {
+		id, ok := ownerID(r)
+		return ok && id == authUser.ID
+	}
+}
+
+// userPolicy only lets users modify their own account.
+var userPolicy = ownerPolicy(func(r *http.Request) (int64, bool) {
+	user := getUserFromCtx(r)
+	if user == nil {
+		return 0, false
+	}
+	return user.ID, true
+})
+
+// outranksPolicy only allows acting on users with a less privileged role, so
+// moderators can't suspend each other and admins can only be managed
+// directly in the database.
+var outranksPolicy policy = func(authUser *store.User, r *http.Request) bool {
+	user := getUserFromCtx(r)
+	return user != nil && authUser.Role.Level > user.Role.Level
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+// access is something a user wants to do with another user's account
+type access int
+
+const (
+	accessProfile  access = iota // see the account, its profile and avatar
+	accessFriends                // see the account's friends list
+	accessSendCard               // send the account a card
+)
+
+var (
+	errPrivateAccount   = errors.New("this account is private")
+	errFriendsHidden    = errors.New("this user's friends list is hidden")
+	errCardsNotAccepted = errors.New("this user doesn't accept cards from you")
+)
+
+// checkAccess is the one place that decides whether the viewer may do
+// something with the owner's account, following the owner's privacy
+// settings. It returns one of the errors above when they may not, which
+// isAccessDenied recognises. Users that blocked one another don't exist to
+// each other, so a block returns store.ErrNotFound whatever the access.
+func (app *application) checkAccess(ctx context.Context, viewer *store.User, ownerID int64, a access) error {
+	if viewer.ID == ownerID {
+		return nil
+	}
+
+	blocked, err := app.store.Blocks.IsBlocked(ctx, viewer.ID, ownerID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return store.ErrNotFound
+	}
+
+	settings, err := app.store.PrivacySettings.GetByUserID(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+
+	// nothing but cards gets through a private account to strangers
+	if settings.Private && a != accessSendCard {
+		ok, err := app.inAudience(ctx, viewer.ID, ownerID, store.AudienceFriends)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errPrivateAccount
+		}
+	}
+
+	switch a {
+	case accessFriends:
+		ok, err := app.inAudience(ctx, viewer.ID, ownerID, settings.FriendsVisibility)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errFriendsHidden
+		}
+	case accessSendCard:
+		ok, err := app.inAudience(ctx, viewer.ID, ownerID, settings.CardSenders)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errCardsNotAccepted
+		}
+	}
+
+	return nil
+}
+
+func isAccessDenied(err error) bool {
+	return err == errPrivateAccount || err == errFriendsHidden || err == errCardsNotAccepted
+}
+
+// accessErrorResponse answers a request checkAccess turned away
+func (app *application) accessErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case err == store.ErrNotFound:
+		app.notFoundResponse(w, r, err)
+	case isAccessDenied(err):
+		app.forbiddenResponse(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
+
+// inAudience reports whether the viewer belongs to the audience the owner
+// opened a setting up to.
+func (app *application) inAudience(ctx context.Context, viewerID, ownerID int64, audience string) (bool, error) {
+	switch audience {
+	case store.AudienceEveryone:
+		return true, nil
+	case store.AudienceFollowers:
+		// the owner following the viewer lets the viewer send them cards
+		following, err := app.store.Followers.IsFollowing(ctx, viewerID, ownerID)
+		if err != nil || following {
+			return following, err
+		}
+		return app.store.Friends.IsFriend(ctx, ownerID, viewerID)
+	case store.AudienceFriends:
+		return app.store.Friends.IsFriend(ctx, ownerID, viewerID)
+	default:
+		return false, nil
+	}
+}
+
+// requireAccess only lets the request through if the authenticated user has
+// the access to the user in the request context.
+func (app *application) requireAccess(a access) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := getUserFromCtx(r)
+
+			if err := app.checkAccess(r.Context(), getAuthUserFromCtx(r), user.ID, a); err != nil {
+				app.accessErrorResponse(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type UpdatePrivacyPayload struct {
+	Private           *bool   `json:"private"`
+	CardSenders       *string `json:"card_senders" validate:"omitempty,oneof=everyone followers friends nobody"`
+	FriendsVisibility *string `json:"friends_visibility" validate:"omitempty,oneof=everyone followers friends nobody"`
+}
+
+// getPrivacyHandler godoc
+//
+// @Summary Get your privacy settings
+// @Tags me
+// @Produce json
+// @Success 200 {object} store.PrivacySettings "Privacy settings"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/privacy [get]
+func (app *application) getPrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	settings, err := app.store.PrivacySettings.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, settings); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// updatePrivacyHandler godoc
+//
+// @Summary Update your privacy settings
+// @Description Only the fields present in the payload are changed. Audiences are everyone, followers (friends and the users you follow), friends or nobody.
+// @Tags me
+// @Accept json
+// @Produce json
+// @Param payload body UpdatePrivacyPayload true "Settings to change"
+// @Success 200 {object} store.PrivacySettings "Updated privacy settings"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/privacy [patch]
+func (app *application) updatePrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	var payload UpdatePrivacyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	settings, err := app.store.PrivacySettings.GetByUserID(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if payload.Private != nil {
+		settings.Private = *payload.Private
+	}
+
+	if payload.CardSenders != nil {
+		settings.CardSenders = *payload.CardSenders
+	}
+
+	if payload.FriendsVisibility != nil {
+		settings.FriendsVisibility = *payload.FriendsVisibility
+	}
+
+	if err := app.store.PrivacySettings.Update(ctx, settings); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, settings); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+// fakeBlocks reports every pair of users as blocked.
+type fakeBlocks struct {
+	*store.BlockStore
+}
+
+func (fakeBlocks) IsBlocked(ctx context.Context, userID, otherID int64) (bool, error) {
+	return true, nil
+}
+
+// fakePrivacySettings gives every account the most open settings.
+type fakePrivacySettings struct {
+	*store.PrivacySettingsStore
+}
+
+func (fakePrivacySettings) GetByUserID(ctx context.Context, userID int64) (*store.PrivacySettings, error) {
+	return &store.PrivacySettings{
+		UserID:            userID,
+		CardSenders:       store.AudienceEveryone,
+		FriendsVisibility: store.AudienceEveryone,
+	}, nil
+}
+
+func TestCheckAccessBlocked(t *testing.T) {
+	app := &application{
+		store: store.Storage{
+			Blocks:          fakeBlocks{},
+			PrivacySettings: fakePrivacySettings{},
+		},
+	}
+
+	user := &store.User{ID: 1, Role: store.Role{Name: store.RoleUser, Level: 1}}
+	moderator := &store.User{ID: 2, Role: store.Role{Name: store.RoleModerator, Level: 2}}
+	admin := &store.User{ID: 3, Role: store.Role{Name: store.RoleAdmin, Level: 3}}
+
+	tests := []struct {
+		name   string
+		viewer *store.User
+		access access
+		want   error
+	}{
+		{"user profile", user, accessProfile, store.ErrNotFound},
+		{"user friends", user, accessFriends, store.ErrNotFound},
+		{"user card", user, accessSendCard, store.ErrNotFound},
+		{"moderator profile", moderator, accessProfile, store.ErrNotFound},
+		{"moderator friends", moderator, accessFriends, store.ErrNotFound},
+		{"moderator card", moderator, accessSendCard, store.ErrNotFound},
+		{"admin profile", admin, accessProfile, store.ErrNotFound},
+		{"admin card", admin, accessSendCard, store.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := app.checkAccess(context.Background(), tt.viewer, 42, tt.access); err != tt.want {
+				t.Errorf("checkAccess() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
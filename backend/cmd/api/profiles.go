@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+const (
+	maxAvatarBytes = 1 << 20 // 1mb
+	maxAvatarSide  = 1024    // pixels
+	birthdayLayout = "2006-01-02"
+)
+
+var (
+	errControlCharacters = errors.New("must not contain control characters")
+	errInvalidBirthday   = errors.New("must be a date formatted as YYYY-MM-DD between 1900 and today")
+	errInvalidAvatar     = errors.New("must be a PNG, JPEG or GIF image of at most 1 MB and 1024x1024 pixels")
+	minBirthday          = time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// ProfileResponse is a user's profile as seen by the requester. The birthday
+// is left out when its visibility doesn't include them.
+type ProfileResponse struct {
+	UserID             int64   `json:"user_id"`
+	DisplayName        string  `json:"display_name"`
+	Bio                string  `json:"bio"`
+	Pronouns           string  `json:"pronouns"`
+	Birthday           *string `json:"birthday,omitempty"`            // YYYY-MM-DD
+	BirthdayVisibility string  `json:"birthday_visibility,omitempty"` // only shown to the owner
+	Timezone           string  `json:"timezone"`
+	AvatarURL          *string `json:"avatar_url"`
+}
+
+func newProfileResponse(profile *store.Profile, isOwner, showBirthday bool) ProfileResponse {
+	res := ProfileResponse{
+		UserID:      profile.UserID,
+		DisplayName: profile.DisplayName,
+		Bio:         profile.Bio,
+		Pronouns:    profile.Pronouns,
+		Timezone:    profile.Timezone,
+	}
+
+	if isOwner {
+		res.BirthdayVisibility = profile.BirthdayVisibility
+	}
+
+	if showBirthday && profile.Birthday != nil {
+		birthday := profile.Birthday.Format(birthdayLayout)
+		res.Birthday = &birthday
+	}
+
+	// the version busts caches when the avatar is replaced
+	if profile.AvatarUpdatedAt != nil {
+		url := fmt.Sprintf("/v1/users/%d/avatar?v=%d", profile.UserID, profile.AvatarUpdatedAt.Unix())
+		res.AvatarURL = &url
+	}
+
+	return res
+}
+
+// canSeeBirthday reports whether the viewer may see the birthday on the
+// profile.
+func (app *application) canSeeBirthday(ctx context.Context, viewer *store.User, profile *store.Profile) (bool, error) {
+	if viewer.ID == profile.UserID {
+		return true, nil
+	}
+
+	switch profile.BirthdayVisibility {
+	case store.BirthdayPublic:
+		return app.inAudience(ctx, viewer.ID, profile.UserID, store.AudienceEveryone)
+	case store.BirthdayFriends:
+		return app.inAudience(ctx, viewer.ID, profile.UserID, store.AudienceFriends)
+	default:
+		return false, nil
+	}
+}
+
+type UpdateProfilePayload struct {
+	DisplayName        *string `json:"display_name" validate:"omitempty,max=50"`
+	Bio                *string `json:"bio" validate:"omitempty,max=300"`
+	Pronouns           *string `json:"pronouns" validate:"omitempty,max=40"`
+	Birthday           *string `json:"birthday"` // YYYY-MM-DD, empty to remove it
+	BirthdayVisibility *string `json:"birthday_visibility" validate:"omitempty,oneof=public friends private"`
+	Timezone           *string `json:"timezone" validate:"omitempty,timezone"`
+}
+
+// getProfileHandler godoc
+//
+// @Summary Get a user's profile
+// @Description The birthday is only included if its visibility allows the requester to see it
+// @Tags users
+// @Produce json
+// @Param userID path int true "User ID"
+// @Success 200 {object} ProfileResponse "Profile"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Private account"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/{userID}/profile [get]
+func (app *application) getProfileHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	viewer := getAuthUserFromCtx(r)
+	ctx := r.Context()
+
+	profile, err := app.store.Profiles.GetByUserID(ctx, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	showBirthday, err := app.canSeeBirthday(ctx, viewer, profile)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	res := newProfileResponse(profile, viewer.ID == user.ID, showBirthday)
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// updateProfileHandler godoc
+//
+// @Summary Update your profile
+// @Description Only the fields present in the payload are changed
+// @Tags me
+// @Accept json
+// @Produce json
+// @Param payload body UpdateProfilePayload true "Profile fields to change"
+// @Success 200 {object} ProfileResponse "Updated profile"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/profile [patch]
+func (app *application) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	var payload UpdateProfilePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	profile, err := app.store.Profiles.GetByUserID(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if payload.DisplayName != nil {
+		name := strings.TrimSpace(*payload.DisplayName)
+		if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+			app.failedValidationResponse(w, r, "display_name", errControlCharacters)
+			return
+		}
+		profile.DisplayName = name
+	}
+
+	if payload.Bio != nil {
+		profile.Bio = strings.TrimSpace(*payload.Bio)
+	}
+
+	if payload.Pronouns != nil {
+		pronouns := strings.TrimSpace(*payload.Pronouns)
+		if strings.IndexFunc(pronouns, unicode.IsControl) >= 0 {
+			app.failedValidationResponse(w, r, "pronouns", errControlCharacters)
+			return
+		}
+		profile.Pronouns = pronouns
+	}
+
+	if payload.Birthday != nil {
+		birthday, err := parseBirthday(*payload.Birthday)
+		if err != nil {
+			app.failedValidationResponse(w, r, "birthday", err)
+			return
+		}
+		profile.Birthday = birthday
+	}
+
+	if payload.BirthdayVisibility != nil {
+		profile.BirthdayVisibility = *payload.BirthdayVisibility
+	}
+
+	if payload.Timezone != nil {
+		profile.Timezone = *payload.Timezone
+	}
+
+	if err := app.store.Profiles.Update(ctx, profile); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, newProfileResponse(profile, true, true)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// parseBirthday parses a YYYY-MM-DD date, returning nil for an empty one.
+func parseBirthday(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	birthday, err := time.Parse(birthdayLayout, s)
+	if err != nil || birthday.Before(minBirthday) || birthday.After(time.Now()) {
+		return nil, errInvalidBirthday
+	}
+
+	return &birthday, nil
+}
+
+// getAvatarHandler godoc
+//
+// @Summary Get a user's avatar
+// @Tags users
+// @Produce image/png,image/jpeg,image/gif
+// @Param userID path int true "User ID"
+// @Success 200 {file} file "Avatar image"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Private account"
+// @Failure 404 {object} ErrorResponse "User or avatar not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/{userID}/avatar [get]
+func (app *application) getAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	avatar, err := app.store.Profiles.GetAvatar(r.Context(), user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", avatar.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, "", avatar.UpdatedAt, bytes.NewReader(avatar.Data))
+}
+
+// updateAvatarHandler godoc
+//
+// @Summary Upload your avatar
+// @Description Replace the avatar with the image in the request body
+// @Tags me
+// @Accept image/png,image/jpeg,image/gif
+// @Produce json
+// @Success 200 {object} ProfileResponse "Updated profile"
+// @Failure 400 {object} ErrorResponse "Not a supported image"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/avatar [put]
+func (app *application) updateAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAvatarBytes))
+	if err != nil {
+		app.failedValidationResponse(w, r, "avatar", errInvalidAvatar)
+		return
+	}
+
+	// the content is checked rather than trusting the Content-Type header
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width > maxAvatarSide || config.Height > maxAvatarSide {
+		app.failedValidationResponse(w, r, "avatar", errInvalidAvatar)
+		return
+	}
+
+	ctx := r.Context()
+
+	avatar := &store.Avatar{
+		UserID:      user.ID,
+		ContentType: "image/" + format,
+		Data:        data,
+	}
+
+	if err := app.store.Profiles.SetAvatar(ctx, avatar); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	profile, err := app.store.Profiles.GetByUserID(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, newProfileResponse(profile, true, true)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteAvatarHandler godoc
+//
+// @Summary Remove your avatar
+// @Tags me
+// @Success 204 "Avatar removed"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "No avatar to remove"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/avatar [delete]
+func (app *application) deleteAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	if err := app.store.Profiles.DeleteAvatar(r.Context(), user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+type SessionResponse struct {
+	*store.UserToken
+	Current bool `json:"current"` // session the request was made with
+}
+
+// createSession opens a new session for the user and returns the plain
+// refresh token that identifies it.
+func (app *application) createSession(r *http.Request, userID int64) (string, *store.UserToken, error) {
+	refreshToken := uuid.New().String()
+
+	session := &store.UserToken{
+		Token:     hashToken(refreshToken),
+		UserID:    userID,
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+		ExpiresAt: time.Now().Add(app.config.auth.token.refreshExp),
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.UserTokens.Issue(ctx, session); err != nil {
+		return "", nil, err
+	}
+
+	// a successful sign-in starts the failed attempt count over
+	if err := app.store.LoginAttempts.Clear(ctx, userID); err != nil {
+		return "", nil, err
+	}
+
+	app.audit(r, store.EventLoginSucceeded, userID, map[string]any{"session_id": session.ID})
+
+	return refreshToken, session, nil
+}
+
+// listSessionsHandler godoc
+//
+// @Summary List sessions
+// @Description List the active sessions of the authenticated user
+// @Tags me
+// @Produce json
+// @Success 200 {array} SessionResponse "Sessions"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/sessions [get]
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+	currentID := getSessionIDFromCtx(r)
+
+	sessions, err := app.store.UserTokens.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	res := make([]SessionResponse, len(sessions))
+	for i, session := range sessions {
+		res[i] = SessionResponse{
+			UserToken: session,
+			Current:   session.ID == currentID,
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteSessionHandler godoc
+//
+// @Summary Revoke a session
+// @Description Revoke one of the authenticated user's sessions
+// @Tags me
+// @Param sessionID path int true "Session ID"
+// @Success 204 "Session revoked"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Session not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/sessions/{sessionID} [delete]
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	session, err := app.store.UserTokens.GetByID(ctx, id)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// don't reveal other users' sessions
+	if session.UserID != user.ID {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	if err := app.store.UserTokens.Delete(ctx, session.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, store.EventSessionRevoked, user.ID, map[string]any{"session_id": session.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteAllSessionsHandler godoc
+//
+// @Summary Log out everywhere
+// @Description Revoke every session of the authenticated user, including the current one
+// @Tags me
+// @Success 204 "Sessions revoked"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/sessions [delete]
+func (app *application) deleteAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	if err := app.store.UserTokens.DeleteByUserID(r.Context(), user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, store.EventSessionsRevoked, user.ID, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
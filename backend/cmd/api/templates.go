@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+var errEditConflict = errors.New("the resource was changed by someone else, reload it and try again")
+
+type CreateTemplatePayload struct {
+	Title       string          `json:"title" validate:"required,max=255"`
+	Description string          `json:"description" validate:"max=255"`
+	Data        json.RawMessage `json:"data" validate:"required"`
+}
+
+type UpdateTemplatePayload struct {
+	Title       *string         `json:"title" validate:"omitempty,max=255"`
+	Description *string         `json:"description" validate:"omitempty,max=255"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// listTemplatesHandler godoc
+//
+// @Summary List card templates
+// @Tags templates
+// @Produce json
+// @Param limit query int false "Page size" default(20)
+// @Param offset query int false "Page offset" default(0)
+// @Success 200 {array} store.Template "Templates"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/templates [get]
+func (app *application) listTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := readPagination(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	templates, err := app.store.Templates.List(r.Context(), limit, offset)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, templates); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getTemplateHandler godoc
+//
+// @Summary Get a card template
+// @Tags templates
+// @Produce json
+// @Param templateID path int true "Template ID"
+// @Success 200 {object} store.Template "Template"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/templates/{templateID} [get]
+func (app *application) getTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := app.loadTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, template); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// createTemplateHandler godoc
+//
+// @Summary Create a card template
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param payload body CreateTemplatePayload true "Template"
+// @Success 201 {object} store.Template "Template created"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/templates [post]
+func (app *application) createTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateTemplatePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	template := &store.Template{
+		Title:       payload.Title,
+		Description: payload.Description,
+		Data:        payload.Data,
+	}
+
+	if err := app.store.Templates.Publish(r.Context(), template); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, template); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// updateTemplateHandler godoc
+//
+// @Summary Update a card template
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param templateID path int true "Template ID"
+// @Param payload body UpdateTemplatePayload true "Fields to change"
+// @Success 200 {object} store.Template "Template updated"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Template not found"
+// @Failure 409 {object} ErrorResponse "Template was changed concurrently"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/templates/{templateID} [patch]
+func (app *application) updateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := app.loadTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	var payload UpdateTemplatePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if payload.Title != nil {
+		template.Title = *payload.Title
+	}
+	if payload.Description != nil {
+		template.Description = *payload.Description
+	}
+	if payload.Data != nil {
+		template.Data = payload.Data
+	}
+
+	// the update only applies if nobody changed the template since we read it
+	if err := app.store.Templates.Update(r.Context(), template); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.conflictResponse(w, r, errEditConflict)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, template); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) loadTemplate(w http.ResponseWriter, r *http.Request) (*store.Template, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "templateID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	template, err := app.store.Templates.GetByID(r.Context(), id)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return template, true
+}
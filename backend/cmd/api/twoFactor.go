@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gratefulness-app/grace/internal/auth"
+	"github.com/gratefulness-app/grace/internal/store"
+)
+
+const (
+	totpIssuer        = "Grace"
+	recoveryCodeCount = 10
+	mfaTokenExp       = time.Minute * 5
+	maxMFAAttempts    = 5 // codes that can be tried before signing in again
+)
+
+var (
+	errTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	errTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	errTwoFactorNotPending = errors.New("two-factor authentication enrolment was not started")
+	errInvalidCode         = errors.New("invalid two-factor authentication code")
+	errInvalidMFAToken     = errors.New("invalid, used or expired mfa token")
+)
+
+type TwoFactorCodePayload struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type CreateMFATokenPayload struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required,max=32"`
+}
+
+type TOTPEnrolmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+// InvalidCodeResponse rejects a wrong code. The mfa token it came with is used
+// up, MFAToken replaces it until the attempts run out.
+type InvalidCodeResponse struct {
+	Error    string `json:"error"`
+	MFAToken string `json:"mfa_token,omitempty"`
+}
+
+// enrolTwoFactorHandler godoc
+//
+// @Summary Start 2FA enrolment
+// @Description Generate a TOTP secret for the authenticated user. It has to be confirmed with a code before 2FA is enabled.
+// @Tags me
+// @Produce json
+// @Success 201 {object} TOTPEnrolmentResponse "TOTP secret"
+// @Failure 400 {object} ErrorResponse "2FA already enabled"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/2fa [post]
+func (app *application) enrolTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	if user.TOTPEnabled {
+		app.badRequestResponse(w, r, errTwoFactorEnabled)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.TwoFactor.SetPendingSecret(r.Context(), user.ID, secret); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.badRequestResponse(w, r, errTwoFactorEnabled)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	res := TOTPEnrolmentResponse{
+		Secret: secret,
+		URI:    auth.TOTPURI(totpIssuer, user.Email, secret),
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// confirmTwoFactorHandler godoc
+//
+// @Summary Confirm 2FA enrolment
+// @Description Enable 2FA with a code from the authenticator app. Returns one-time recovery codes, which are only ever shown once.
+// @Tags me
+// @Accept json
+// @Produce json
+// @Param payload body TwoFactorCodePayload true "TOTP code"
+// @Success 200 {object} RecoveryCodesResponse "Recovery codes"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/2fa/confirm [post]
+func (app *application) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	var payload TwoFactorCodePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if user.TOTPEnabled {
+		app.badRequestResponse(w, r, errTwoFactorEnabled)
+		return
+	}
+
+	if user.TOTPSecret == "" {
+		app.badRequestResponse(w, r, errTwoFactorNotPending)
+		return
+	}
+
+	ctx := r.Context()
+
+	ok, err := app.verifyTOTP(ctx, user, payload.Code)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !ok {
+		app.badRequestResponse(w, r, errInvalidCode)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashToken(auth.NormalizeRecoveryCode(code))
+	}
+
+	if err := app.store.TwoFactor.Enable(ctx, user.ID, hashes); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, RecoveryCodesResponse{codes}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// disableTwoFactorHandler godoc
+//
+// @Summary Disable 2FA
+// @Description Disable 2FA. Requires a valid TOTP or recovery code.
+// @Tags me
+// @Accept json
+// @Param payload body TwoFactorCodePayload true "TOTP or recovery code"
+// @Success 204 "2FA disabled"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me/2fa [delete]
+func (app *application) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	var payload TwoFactorCodePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !user.TOTPEnabled {
+		app.badRequestResponse(w, r, errTwoFactorNotEnabled)
+		return
+	}
+
+	ctx := r.Context()
+
+	ok, err := app.verifySecondFactor(ctx, user, payload.Code)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !ok {
+		app.badRequestResponse(w, r, errInvalidCode)
+		return
+	}
+
+	if err := app.store.TwoFactor.Disable(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createMFATokenHandler godoc
+//
+// @Summary Complete a 2FA login
+// @Description Exchange the MFA token returned by the token endpoint and a TOTP or recovery code for an access and refresh token. Every MFA token can be used once, though an attempt turned away with 429 leaves it unused; a wrong code is answered with a replacement until too many codes were tried.
+// @Tags authentication
+// @Accept json
+// @Produce json
+// @Param payload body CreateMFATokenPayload true "MFA token and code"
+// @Success 201 {object} TokenResponse "Tokens"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} InvalidCodeResponse "Unauthorized"
+// @Failure 429 {object} ErrorResponse "Too many failed attempts"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/authentication/token/2fa [post]
+func (app *application) createMFATokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateMFATokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// only look the token up for now, a throttled attempt mustn't use it up
+	challenge, err := app.store.TwoFactor.GetChallenge(ctx, hashToken(payload.MFAToken))
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, errInvalidMFAToken)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.store.Users.GetByID(ctx, challenge.UserID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if !user.TOTPEnabled {
+		app.unauthorizedErrorResponse(w, r, errTwoFactorNotEnabled)
+		return
+	}
+
+	// the account may have been suspended or deleted after the first factor
+	// was checked
+	if err := inactiveAccountErr(user); err != nil {
+		app.forbiddenResponse(w, r, err)
+		return
+	}
+
+	// codes are short, so guessing them is throttled like passwords
+	retryAfter, err := app.loginRetryAfter(ctx, r, user.Email, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.rateLimitExceededResponse(w, r, retryAfter)
+		return
+	}
+
+	// the token is used up whether the code turns out right or wrong
+	challenge, err = app.store.TwoFactor.ConsumeChallenge(ctx, challenge.Token)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, errInvalidMFAToken)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	ok, err := app.verifySecondFactor(ctx, user, payload.Code)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !ok {
+		if err := app.recordLoginFailure(ctx, r, "two_factor", user.Email, user); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		app.invalidCodeResponse(w, r, challenge)
+		return
+	}
+
+	refreshToken, session, err := app.createSession(r, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.writeTokens(w, r, session, refreshToken)
+}
+
+// writeMFAChallenge responds with a short-lived token that can only be used to
+// finish logging in with a second factor.
+func (app *application) writeMFAChallenge(w http.ResponseWriter, r *http.Request, userID int64) {
+	token, err := app.issueMFAChallenge(r.Context(), userID, 0, time.Now().Add(mfaTokenExp))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	res := MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token,
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// invalidCodeResponse answers a wrong code checked against the challenge.
+// While attempts remain it hands out a replacement challenge with the same
+// expiry, so a typo doesn't mean entering the password again.
+func (app *application) invalidCodeResponse(w http.ResponseWriter, r *http.Request, challenge *store.MFAChallenge) {
+	log.Printf("unauthorized error: %s path: %s error: %s", r.Method, r.URL.Path, errInvalidCode.Error())
+
+	res := InvalidCodeResponse{Error: "unauthorized"}
+
+	if attempts := challenge.Attempts + 1; attempts < maxMFAAttempts {
+		token, err := app.issueMFAChallenge(r.Context(), challenge.UserID, attempts, challenge.ExpiresAt)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		res.MFAToken = token
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="restricted"`)
+
+	writeJSON(w, http.StatusUnauthorized, res)
+}
+
+// issueMFAChallenge stores a challenge and returns the plain token for it.
+func (app *application) issueMFAChallenge(ctx context.Context, userID int64, attempts int, expiresAt time.Time) (string, error) {
+	plainToken := uuid.New().String()
+
+	challenge := &store.MFAChallenge{
+		Token:     hashToken(plainToken),
+		UserID:    userID,
+		Attempts:  attempts,
+		ExpiresAt: expiresAt,
+	}
+
+	if err := app.store.TwoFactor.CreateChallenge(ctx, challenge); err != nil {
+		return "", err
+	}
+
+	return plainToken, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+// Both are single-use.
+func (app *application) verifySecondFactor(ctx context.Context, user *store.User, code string) (bool, error) {
+	ok, err := app.verifyTOTP(ctx, user, code)
+	if err != nil || ok {
+		return ok, err
+	}
+
+	err = app.store.TwoFactor.UseRecoveryCode(ctx, user.ID, hashToken(auth.NormalizeRecoveryCode(code)))
+	switch err {
+	case nil:
+		return true, nil
+	case store.ErrNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func (app *application) verifyTOTP(ctx context.Context, user *store.User, code string) (bool, error) {
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	// reject codes that were already used
+	err := app.store.TwoFactor.UseStep(ctx, user.ID, step)
+	switch err {
+	case nil:
+		return true, nil
+	case store.ErrNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+}
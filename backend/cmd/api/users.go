@@ -1,12 +1,20 @@
 package main
 
 import (
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/gratefulness-app/grace/internal/mailer"
 	"github.com/gratefulness-app/grace/internal/store"
+	"github.com/gratefulness-app/grace/internal/usernames"
 	"golang.org/x/net/context"
 )
 
@@ -14,17 +22,159 @@ type userKey string
 
 const userCtx userKey = "user"
 
+// UserResponse is the public profile every user can see.
+type UserResponse struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MeResponse is the full account, only ever shown to its owner.
+type MeResponse struct {
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	Verified    bool      `json:"verified"`
+	TOTPEnabled bool      `json:"totp_enabled"`
+	Role        string    `json:"role"`
+	InvitedBy   *int64    `json:"invited_by"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newUserResponse(user *store.User) UserResponse {
+	return UserResponse{
+		ID:        user.ID,
+		Username:  user.Username,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+func newMeResponse(user *store.User) MeResponse {
+	return MeResponse{
+		ID:          user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		Verified:    user.Verified,
+		TOTPEnabled: user.TOTPEnabled,
+		Role:        user.Role.Name,
+		InvitedBy:   user.InvitedBy,
+		UpdatedAt:   user.UpdatedAt,
+		CreatedAt:   user.CreatedAt,
+	}
+}
+
+// getUserHandler godoc
+//
+// @Summary Get a user
+// @Description Get a user's profile. Owners get their full account, everyone else the public profile.
+// @Tags users
+// @Produce json
+// @Param userID path int true "User ID"
+// @Success 200 {object} UserResponse "Public profile"
+// @Success 200 {object} MeResponse "Own account"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Private account"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/{userID} [get]
 func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromCtx(r)
 
-	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+	var res any = newUserResponse(user)
+	if authUser := getAuthUserFromCtx(r); authUser != nil && authUser.ID == user.ID {
+		res = newMeResponse(user)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
 
+// getUserByUsernameHandler godoc
+//
+// @Summary Find a user by username
+// @Description Usernames are case insensitive. A username given up within the hold period redirects to the user's current one.
+// @Tags users
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {object} UserResponse "Public profile"
+// @Success 307 "Redirect to the current username"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Private account"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/users/by-username/{username} [get]
+func (app *application) getUserByUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	ctx := r.Context()
+
+	renamed := false
+	user, err := app.store.Users.GetByUsername(ctx, username)
+	if err == store.ErrNotFound {
+		user, err = app.store.Users.GetByPreviousUsername(ctx, username)
+		renamed = err == nil
+	}
+
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if user.PurgeAt != nil {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	if err := app.checkAccess(ctx, getAuthUserFromCtx(r), user.ID, accessProfile); err != nil {
+		app.accessErrorResponse(w, r, err)
+		return
+	}
+
+	// only redirect once it's clear the new username may be revealed
+	if renamed {
+		http.Redirect(w, r, "/v1/users/by-username/"+url.PathEscape(user.Username), http.StatusTemporaryRedirect)
+		return
+	}
+
+	var res any = newUserResponse(user)
+	if authUser := getAuthUserFromCtx(r); authUser != nil && authUser.ID == user.ID {
+		res = newMeResponse(user)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getMeHandler godoc
+//
+// @Summary Get the authenticated user
+// @Tags me
+// @Produce json
+// @Success 200 {object} MeResponse "Own account"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Security ApiKeyAuth
+// @Router /v1/me [get]
+func (app *application) getMeHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromCtx(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, newMeResponse(user)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
 type UpdateUserPayload struct {
-	Username *string `json:"username" validate:"omitempty,max=35"`
+	Username *string `json:"username" validate:"omitempty,max=64"`
 	Email    *string `json:"email" validate:"omitempty,email"`
 }
 
@@ -42,50 +192,179 @@ func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	previousUsername := user.Username
 	if payload.Username != nil {
-		user.Username = *payload.Username
+		username, err := usernames.Normalize(*payload.Username)
+		if err != nil {
+			app.failedValidationResponse(w, r, "username", err)
+			return
+		}
+		user.Username = username
 	}
 
-	if payload.Email != nil {
-		user.Email = *payload.Email
+	ctx := r.Context()
+
+	// the new email only replaces the current one once it is confirmed
+	changeEmail := payload.Email != nil && !strings.EqualFold(*payload.Email, user.Email)
+	if changeEmail {
+		if err := app.checkEmailAvailable(ctx, *payload.Email); err != nil {
+			switch err {
+			case store.ErrDuplicateEmail:
+				app.badRequestResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
 	}
 
-	if err := app.store.Users.Update(r.Context(), user); err != nil {
-		app.internalServerError(w, r, err)
+	if err := app.store.Users.Update(ctx, user); err != nil {
+		switch err {
+		case store.ErrDuplicateUsername:
+			app.badRequestResponse(w, r, err)
+		case store.ErrNotFound:
+			app.conflictResponse(w, r, errEditConflict)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+	if user.Username != previousUsername {
+		app.audit(r, store.EventUsernameChanged, user.ID, map[string]any{"from": previousUsername, "to": user.Username})
+	}
+
+	// only once the rest of the update went through
+	if changeEmail {
+		if err := app.requestEmailChange(ctx, user, *payload.Email); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		app.audit(r, store.EventEmailChangeRequest, user.ID, nil)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, newMeResponse(user)); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
 
-func (app *application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "userID")
-	id, err := strconv.ParseInt(idParam, 10, 64)
+// activateUserHandler godoc
+//
+// @Summary Activate a user
+// @Description Activate a user with the token sent on registration
+// @Tags users
+// @Produce json
+// @Param token path string true "Invitation token"
+// @Success 204 "User activated"
+// @Failure 404 {object} ErrorResponse "Token not found or expired"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/users/activate/{token} [put]
+func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
 
+	userID, err := app.store.Users.Activate(r.Context(), hashToken(token))
 	if err != nil {
-		app.internalServerError(w, r, err)
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
-	ctx := r.Context()
+	app.audit(r, store.EventActivated, userID, nil)
 
-	if err := app.store.Users.Delete(ctx, id); err != nil {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// confirmEmailHandler godoc
+//
+// @Summary Confirm an email change
+// @Description Swap in the new email address with the token sent to it
+// @Tags users
+// @Param token path string true "Email change token"
+// @Success 204 "Email changed"
+// @Failure 400 {object} ErrorResponse "Email already taken"
+// @Failure 404 {object} ErrorResponse "Token not found or expired"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/users/email/{token} [put]
+func (app *application) confirmEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	userID, err := app.store.Users.ConfirmEmailChange(r.Context(), hashToken(token))
+	if err != nil {
 		switch err {
 		case store.ErrNotFound:
 			app.notFoundResponse(w, r, err)
-			return
+		case store.ErrDuplicateEmail:
+			app.badRequestResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
 		return
 	}
 
+	app.audit(r, store.EventEmailChanged, userID, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// checkEmailAvailable returns store.ErrDuplicateEmail when another account
+// already uses the email. Confirming the change checks again.
+func (app *application) checkEmailAvailable(ctx context.Context, email string) error {
+	_, err := app.store.Users.GetByEmail(ctx, email)
+	switch err {
+	case nil:
+		return store.ErrDuplicateEmail
+	case store.ErrNotFound:
+		return nil
+	default:
+		return err
+	}
+}
+
+// requestEmailChange records a pending email change, sends the confirmation
+// link to the new address and a heads-up to the current one.
+func (app *application) requestEmailChange(ctx context.Context, user *store.User, newEmail string) error {
+	plainToken := uuid.New().String()
+
+	if err := app.store.Users.CreateEmailChange(ctx, user.ID, newEmail, hashToken(plainToken), app.config.mail.emailChangeExp); err != nil {
+		return err
+	}
+
+	confirmVars := struct {
+		Username   string
+		ConfirmURL string
+	}{
+		Username:   user.Username,
+		ConfirmURL: fmt.Sprintf("%s/confirm-email/%s", app.config.frontendURL, plainToken),
+	}
+
+	if err := app.mailer.Send(mailer.EmailChangeTemplate, user.Username, newEmail, confirmVars); err != nil {
+		return err
+	}
+
+	noticeVars := struct {
+		Username string
+		NewEmail string
+	}{
+		Username: user.Username,
+		NewEmail: newEmail,
+	}
+
+	username, email := user.Username, user.Email
+	app.background(func() {
+		if err := app.mailer.Send(mailer.EmailNoticeTemplate, username, email, noticeVars); err != nil {
+			log.Printf("error sending email change notice: %s", err.Error())
+		}
+	})
+
+	return nil
+}
+
 func getUserFromCtx(r *http.Request) *store.User {
 	user, _ := r.Context().Value(userCtx).(*store.User)
 	return user
@@ -114,6 +393,12 @@ func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// accounts pending deletion are hidden from everyone
+		if user.PurgeAt != nil {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+
 		ctx = context.WithValue(ctx, userCtx, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
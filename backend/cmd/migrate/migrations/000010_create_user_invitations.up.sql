@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS user_invitations (
+  token VARCHAR(255) PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE user_tokens
+DROP COLUMN IF EXISTS expires_at;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE user_tokens
+ADD COLUMN expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW();
\ No newline at end of file
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_user_tokens_user_id;
+
+ALTER TABLE user_tokens
+DROP COLUMN IF EXISTS user_agent,
+DROP COLUMN IF EXISTS ip,
+DROP COLUMN IF EXISTS last_used_at;
\ No newline at end of file
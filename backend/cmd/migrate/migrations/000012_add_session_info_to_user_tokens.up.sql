@@ -0,0 +1,6 @@
+ALTER TABLE user_tokens
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip VARCHAR(45) NOT NULL DEFAULT '',
+ADD COLUMN last_used_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens (user_id);
\ No newline at end of file
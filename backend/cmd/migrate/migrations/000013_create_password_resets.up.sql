@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS password_resets (
+  token VARCHAR(255) PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
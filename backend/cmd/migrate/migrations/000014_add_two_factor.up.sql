@@ -0,0 +1,13 @@
+ALTER TABLE users
+ADD COLUMN totp_secret VARCHAR(64) NOT NULL DEFAULT '',
+ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code VARCHAR(255) NOT NULL,
+  used_at TIMESTAMP(0) WITH TIME ZONE,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  UNIQUE (user_id, code)
+);
\ No newline at end of file
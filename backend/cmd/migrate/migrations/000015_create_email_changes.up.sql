@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS email_changes (
+  token VARCHAR(255) PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  new_email CITEXT NOT NULL,
+  expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
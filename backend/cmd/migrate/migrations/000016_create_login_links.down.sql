@@ -0,0 +1 @@
+DROP TABLE IF EXISTS login_links;
\ No newline at end of file
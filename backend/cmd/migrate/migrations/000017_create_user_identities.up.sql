@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  provider VARCHAR(50) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  email CITEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  UNIQUE (provider, subject),
+  UNIQUE (user_id, provider)
+);
+
+CREATE TABLE IF NOT EXISTS oidc_states (
+  state VARCHAR(255) PRIMARY KEY,
+  provider VARCHAR(50) NOT NULL,
+  nonce VARCHAR(255) NOT NULL,
+  code_verifier VARCHAR(255) NOT NULL,
+  user_id BIGINT REFERENCES users(id) ON DELETE CASCADE, -- set when linking to an existing account
+  expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS passkeys (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  credential_id BYTEA UNIQUE NOT NULL,
+  public_key BYTEA NOT NULL, -- COSE_Key
+  sign_count BIGINT NOT NULL DEFAULT 0,
+  name VARCHAR(100) NOT NULL,
+  last_used_at TIMESTAMP(0) WITH TIME ZONE,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+  challenge VARCHAR(255) PRIMARY KEY,
+  type VARCHAR(20) NOT NULL,
+  user_id BIGINT REFERENCES users(id) ON DELETE CASCADE, -- set for registrations
+  expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
\ No newline at end of file
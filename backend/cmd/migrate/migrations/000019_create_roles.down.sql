@@ -0,0 +1,5 @@
+ALTER TABLE users
+DROP COLUMN IF EXISTS role_id,
+DROP COLUMN IF EXISTS suspended_at;
+
+DROP TABLE IF EXISTS roles;
\ No newline at end of file
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS roles (
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL UNIQUE,
+  level INT NOT NULL DEFAULT 0,
+  description TEXT
+);
+
+INSERT INTO roles (name, level, description)
+VALUES
+  ('user', 1, 'A user can send cards and manage their own account'),
+  ('moderator', 2, 'A moderator can suspend users and remove cards'),
+  ('admin', 3, 'An admin can manage templates, badges and user roles');
+
+ALTER TABLE users
+ADD COLUMN role_id BIGINT REFERENCES roles(id) DEFAULT 1,
+ADD COLUMN suspended_at TIMESTAMP(0) WITH TIME ZONE;
+
+UPDATE users SET role_id = (SELECT id FROM roles WHERE name = 'user');
+
+ALTER TABLE users ALTER COLUMN role_id SET NOT NULL;
\ No newline at end of file
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS account_unlocks;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS locked_until;
+
+DROP TABLE IF EXISTS login_attempts;
\ No newline at end of file
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+  ip VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_user_id ON login_attempts (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts (ip, created_at);
+
+ALTER TABLE users
+ADD COLUMN locked_until TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS account_unlocks (
+  token VARCHAR(255) PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
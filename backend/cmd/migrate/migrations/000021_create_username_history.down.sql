@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS username_history;
+
+ALTER TABLE users
+ALTER COLUMN username TYPE VARCHAR(255);
\ No newline at end of file
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS username_history (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  username CITEXT NOT NULL,
+  released_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_username_history_username ON username_history (username, released_at);
+
+-- usernames that only differ in case collide once they are compared
+-- case-insensitively. The oldest account keeps the name, the others get
+-- their id appended and the name they had is recorded as released.
+WITH collisions AS (
+  SELECT id, username
+  FROM (
+    SELECT id, username, ROW_NUMBER() OVER (PARTITION BY LOWER(username) ORDER BY id) AS n
+    FROM users
+  ) ranked
+  WHERE n > 1
+), renamed AS (
+  UPDATE users
+  SET username = collisions.username || '_' || collisions.id
+  FROM collisions
+  WHERE users.id = collisions.id
+  RETURNING users.id, collisions.username
+)
+INSERT INTO username_history (user_id, username, released_at)
+SELECT id, username, NOW() + INTERVAL '30 days'
+FROM renamed;
+
+ALTER TABLE users
+ALTER COLUMN username TYPE CITEXT;
\ No newline at end of file
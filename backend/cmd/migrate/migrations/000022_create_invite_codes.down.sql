@@ -0,0 +1,4 @@
+ALTER TABLE users
+DROP COLUMN IF EXISTS invited_by;
+
+DROP TABLE IF EXISTS invite_codes;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS invite_codes (
+  id BIGSERIAL PRIMARY KEY,
+  code VARCHAR(255) NOT NULL UNIQUE,
+  created_by BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  max_uses INT NOT NULL DEFAULT 1,
+  uses INT NOT NULL DEFAULT 0,
+  expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE users
+ADD COLUMN invited_by BIGINT REFERENCES users(id) ON DELETE SET NULL;
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS security_events_append_only ON security_events;
+DROP FUNCTION IF EXISTS security_events_append_only;
+DROP TABLE IF EXISTS security_events;
\ No newline at end of file
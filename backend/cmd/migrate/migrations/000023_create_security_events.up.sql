@@ -0,0 +1,26 @@
+-- user_id and actor_id deliberately have no foreign keys, so the history
+-- outlives the accounts it is about
+CREATE TABLE IF NOT EXISTS security_events (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT,
+  actor_id BIGINT,
+  type VARCHAR(50) NOT NULL,
+  ip VARCHAR(255) NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  request_id VARCHAR(255) NOT NULL DEFAULT '',
+  metadata JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_events_user_id ON security_events (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_security_events_type ON security_events (type, created_at);
+
+CREATE OR REPLACE FUNCTION security_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+  RAISE EXCEPTION 'security_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER security_events_append_only
+BEFORE UPDATE OR DELETE ON security_events
+FOR EACH ROW EXECUTE FUNCTION security_events_append_only();
\ No newline at end of file
@@ -0,0 +1,13 @@
+DELETE FROM cards WHERE user_id IS NULL;
+
+ALTER TABLE cards
+DROP CONSTRAINT IF EXISTS cards_user_id_fkey,
+ADD CONSTRAINT cards_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+ALTER COLUMN user_id SET NOT NULL;
+
+DROP TABLE IF EXISTS account_deletions;
+
+DROP INDEX IF EXISTS idx_users_purge_at;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS purge_at;
\ No newline at end of file
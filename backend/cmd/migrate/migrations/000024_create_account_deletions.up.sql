@@ -0,0 +1,16 @@
+ALTER TABLE users
+ADD COLUMN purge_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_users_purge_at ON users (purge_at) WHERE purge_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS account_deletions (
+  token VARCHAR(255) PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
+
+-- cards outlive their sender, purged accounts leave them without an author
+ALTER TABLE cards
+ALTER COLUMN user_id DROP NOT NULL,
+DROP CONSTRAINT IF EXISTS cards_user_id_fkey,
+ADD CONSTRAINT cards_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
\ No newline at end of file
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS data_exports;
+
+DROP INDEX IF EXISTS idx_notifications_user_id;
+
+ALTER TABLE notifications
+DROP COLUMN IF EXISTS card_id,
+ALTER COLUMN type DROP DEFAULT,
+ALTER COLUMN content DROP DEFAULT;
\ No newline at end of file
@@ -0,0 +1,23 @@
+-- notifications deliver a card to its recipient, which is how received cards
+-- are found
+ALTER TABLE notifications
+ADD COLUMN IF NOT EXISTS card_id BIGINT REFERENCES cards(id) ON DELETE CASCADE,
+ALTER COLUMN type SET DEFAULT 'card_received',
+ALTER COLUMN content SET DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications (user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS data_exports (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  token VARCHAR(255) UNIQUE,
+  archive BYTEA,
+  size BIGINT NOT NULL DEFAULT 0,
+  expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+  completed_at TIMESTAMP(0) WITH TIME ZONE,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- a user can only have one export in progress
+CREATE UNIQUE INDEX IF NOT EXISTS idx_data_exports_pending ON data_exports (user_id) WHERE status = 'pending';
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_avatars;
+DROP TABLE IF EXISTS user_profiles;
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS user_profiles (
+  user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  display_name VARCHAR(50) NOT NULL DEFAULT '',
+  bio VARCHAR(300) NOT NULL DEFAULT '',
+  pronouns VARCHAR(40) NOT NULL DEFAULT '',
+  birthday DATE,
+  birthday_visibility VARCHAR(20) NOT NULL DEFAULT 'private',
+  timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+  updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS user_avatars (
+  user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  content_type VARCHAR(50) NOT NULL,
+  data BYTEA NOT NULL,
+  updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
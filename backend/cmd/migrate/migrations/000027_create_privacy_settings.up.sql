@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS privacy_settings (
+  user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  private BOOLEAN NOT NULL DEFAULT FALSE,
+  card_senders VARCHAR(20) NOT NULL DEFAULT 'followers',
+  friends_visibility VARCHAR(20) NOT NULL DEFAULT 'everyone',
+  updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
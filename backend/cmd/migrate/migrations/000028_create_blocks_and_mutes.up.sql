@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS blocks (
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  blocked_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, blocked_id),
+  CHECK (user_id <> blocked_id)
+);
+
+-- blocks are checked both ways
+CREATE INDEX IF NOT EXISTS idx_blocks_blocked_id ON blocks (blocked_id, user_id);
+
+CREATE TABLE IF NOT EXISTS mutes (
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  muted_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, muted_id),
+  CHECK (user_id <> muted_id)
+);
\ No newline at end of file
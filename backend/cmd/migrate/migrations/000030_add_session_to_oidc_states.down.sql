@@ -0,0 +1,2 @@
+ALTER TABLE oidc_states
+DROP COLUMN IF EXISTS session_id;
\ No newline at end of file
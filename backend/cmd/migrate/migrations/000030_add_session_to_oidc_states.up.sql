@@ -0,0 +1,6 @@
+-- link flows are bound to the session that started them, pending ones
+-- without a session can't be finished anymore
+DELETE FROM oidc_states WHERE user_id IS NOT NULL;
+
+ALTER TABLE oidc_states
+ADD COLUMN session_id BIGINT REFERENCES user_tokens(id) ON DELETE CASCADE;
\ No newline at end of file
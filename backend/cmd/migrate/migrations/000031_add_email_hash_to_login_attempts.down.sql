@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_login_attempts_email_hash;
+
+ALTER TABLE login_attempts
+DROP COLUMN IF EXISTS email_hash;
\ No newline at end of file
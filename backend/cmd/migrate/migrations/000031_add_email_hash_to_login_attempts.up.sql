@@ -0,0 +1,4 @@
+ALTER TABLE login_attempts
+ADD COLUMN email_hash VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_email_hash ON login_attempts (email_hash, created_at);
\ No newline at end of file
@@ -0,0 +1,24 @@
+package auth
+
+import "errors"
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Claims are the registered JWT claims the API relies on.
+type Claims struct {
+	Sub int64  `json:"sub"` // authenticated user id
+	Sid int64  `json:"sid"` // session (user token) the access token belongs to
+	Exp int64  `json:"exp"`
+	Iat int64  `json:"iat"`
+	Nbf int64  `json:"nbf"`
+	Iss string `json:"iss"`
+	Aud string `json:"aud"`
+}
+
+type Authenticator interface {
+	GenerateToken(claims Claims) (string, error)
+	ValidateToken(token string) (*Claims, error)
+}
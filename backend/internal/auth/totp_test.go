@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// base32 of the ASCII secret "12345678901234567890" used by the RFC test vectors
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 appendix D
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+
+	key := []byte("12345678901234567890")
+
+	for counter, code := range want {
+		if got := hotp(key, uint64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, v := range vectors {
+		step, ok := ValidateTOTP(rfcSecret, v.code, time.Unix(v.unix, 0))
+		if !ok {
+			t.Errorf("code %s at %d was rejected", v.code, v.unix)
+			continue
+		}
+		if want := v.unix / totpPeriod; step != want {
+			t.Errorf("code %s at %d matched step %d, want %d", v.code, v.unix, step, want)
+		}
+	}
+
+	now := time.Unix(1234567890, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		at     time.Time
+		ok     bool
+	}{
+		{"current step", rfcSecret, "005924", now, true},
+		{"lowercase secret", strings.ToLower(rfcSecret), "005924", now, true},
+		{"previous step", rfcSecret, "005924", now.Add(totpPeriod * time.Second), true},
+		{"next step", rfcSecret, "005924", now.Add(-totpPeriod * time.Second), true},
+		{"two steps late", rfcSecret, "005924", now.Add(2 * totpPeriod * time.Second), false},
+		{"wrong code", rfcSecret, "005925", now, false},
+		{"too short", rfcSecret, "05924", now, false},
+		{"too long", rfcSecret, "0005924", now, false},
+		{"empty", rfcSecret, "", now, false},
+		{"invalid secret", "not base32!", "005924", now, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(tt.secret, tt.code, tt.at); ok != tt.ok {
+				t.Errorf("ValidateTOTP() = %v, want %v", ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := b32.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q is not base32: %v", secret, err)
+	}
+
+	if len(key) != 20 {
+		t.Errorf("secret is %d bytes, want 20", len(key))
+	}
+
+	other, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if secret == other {
+		t.Error("two secrets are the same")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Grace", "jane@example.com", rfcSecret)
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Errorf("unexpected uri %s", uri)
+	}
+
+	if u.Path != "/Grace:jane@example.com" {
+		t.Errorf("label = %q", u.Path)
+	}
+
+	q := u.Query()
+	for key, want := range map[string]string{
+		"secret":    rfcSecret,
+		"issuer":    "Grace",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	} {
+		if got := q.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(codes) != 10 {
+		t.Fatalf("got %d codes, want 10", len(codes))
+	}
+
+	format := regexp.MustCompile(`^[A-Z2-7]{5}-[A-Z2-7]{5}$`)
+	seen := make(map[string]bool)
+
+	for _, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("code %q is not formatted as XXXXX-XXXXX", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q was generated twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"ABCDE-FGHIJ", "ABCDEFGHIJ"},
+		{"abcde-fghij", "ABCDEFGHIJ"},
+		{"abcde fghij", "ABCDEFGHIJ"},
+		{" ABCDEFGHIJ ", "ABCDEFGHIJ"},
+		{"AB-CDE FG-HIJ", "ABCDEFGHIJ"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeRecoveryCode(tt.in); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LogMailer is a development/test sink. It renders emails like the real
+// mailers but logs them, and additionally writes them to dir when set so the
+// links they contain can be inspected.
+type LogMailer struct {
+	dir string
+}
+
+func NewLog(dir string) *LogMailer {
+	return &LogMailer{dir: dir}
+}
+
+func (m *LogMailer) Send(templateFile, username, email string, data any) error {
+	msg, err := render(templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("email to %s <%s>: %s\n%s", username, email, msg.subject, msg.plainBody)
+
+	if m.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d_%s_%s.eml", time.Now().UnixNano(), email, strings.TrimSuffix(templateFile, ".tmpl"))
+	content := fmt.Sprintf("To: %s <%s>\nSubject: %s\n\n%s\n\n%s", username, email, msg.subject, msg.plainBody, msg.htmlBody)
+
+	return os.WriteFile(filepath.Join(m.dir, name), []byte(content), 0o644)
+}
@@ -0,0 +1,79 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"text/template"
+
+	htmltemplate "html/template"
+)
+
+const (
+	FromName   = "Grace"
+	maxRetries = 3
+
+	UserWelcomeTemplate     = "user_invitation.tmpl"
+	PasswordResetTemplate   = "password_reset.tmpl"
+	CardReceivedTemplate    = "card_received.tmpl"
+	EmailChangeTemplate     = "email_change.tmpl"
+	EmailNoticeTemplate     = "email_change_notice.tmpl"
+	MagicLinkTemplate       = "magic_link.tmpl"
+	AccountLockedTemplate   = "account_locked.tmpl"
+	AccountDeletionTemplate = "account_deletion.tmpl"
+	DataExportTemplate      = "data_export.tmpl"
+)
+
+var ErrPermanent = errors.New("mailer: failed to send email after retries")
+
+//go:embed "templates"
+var FS embed.FS
+
+// Client sends transactional email rendered from one of the embedded
+// templates. Implementations retry transient failures themselves and only
+// return an error once sending has failed permanently.
+type Client interface {
+	Send(templateFile, username, email string, data any) error
+}
+
+// message is a rendered email ready to be handed to a transport.
+type message struct {
+	subject   string
+	plainBody string
+	htmlBody  string
+}
+
+// render executes the subject, plainBody and htmlBody blocks of a template.
+// The html body goes through html/template so user supplied data is escaped.
+func render(templateFile string, data any) (*message, error) {
+	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(plainBody, "plainBody", data); err != nil {
+		return nil, err
+	}
+
+	htmlTmpl, err := htmltemplate.ParseFS(FS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	if err := htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data); err != nil {
+		return nil, err
+	}
+
+	return &message{
+		subject:   subject.String(),
+		plainBody: plainBody.String(),
+		htmlBody:  htmlBody.String(),
+	}, nil
+}
@@ -0,0 +1,104 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+type SMTPMailer struct {
+	fromEmail string
+	addr      string
+	auth      smtp.Auth
+}
+
+func NewSMTP(host string, port int, username, password, fromEmail string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{
+		fromEmail: fromEmail,
+		addr:      fmt.Sprintf("%s:%d", host, port),
+		auth:      auth,
+	}
+}
+
+func (m *SMTPMailer) Send(templateFile, username, email string, data any) error {
+	msg, err := render(templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := m.build(msg, username, email)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < maxRetries; i++ {
+		err = smtp.SendMail(m.addr, m.auth, m.fromEmail, []string{email}, body)
+		if err == nil {
+			return nil
+		}
+
+		log.Printf("Failed to send email to %v, attempt %d of %d: %v", email, i+1, maxRetries, err)
+
+		// no point waiting after the last attempt
+		if i == maxRetries-1 {
+			break
+		}
+
+		// exponential backoff
+		time.Sleep(time.Second * time.Duration(i+1))
+	}
+
+	return fmt.Errorf("%w: %v", ErrPermanent, err)
+}
+
+// build writes a multipart/alternative message with a plain text and an html part.
+func (m *SMTPMailer) build(msg *message, username, email string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	writer := multipart.NewWriter(buf)
+
+	from := mail.Address{Name: FromName, Address: m.fromEmail}
+	to := mail.Address{Name: username, Address: email}
+
+	fmt.Fprintf(buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=UTF-8", msg.plainBody},
+		{"text/html; charset=UTF-8", msg.htmlBody},
+	}
+
+	for _, p := range parts {
+		w, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {p.contentType}})
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := w.Write([]byte(p.body)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,230 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+)
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type keySet struct {
+	keys map[string]crypto.PublicKey
+}
+
+// verify checks the signature and registered claims of an ID token. Keys are
+// refetched once when the token is signed with an unknown kid, which is how
+// providers rotate them.
+func (p *Provider) verify(ctx context.Context, rawToken string) (*Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) != nil {
+			return nil, ErrInvalidIDToken
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(signature) != 64 {
+			return nil, ErrInvalidIDToken
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(k, digest[:], r, s) {
+			return nil, ErrInvalidIDToken
+		}
+	default:
+		return nil, ErrInvalidIDToken
+	}
+
+	var registered struct {
+		Iss string   `json:"iss"`
+		Aud audience `json:"aud"`
+		Exp int64    `json:"exp"`
+	}
+	if err := decodeSegment(parts[1], &registered); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	if registered.Iss != p.cfg.Issuer || !registered.Aud.contains(p.cfg.ClientID) {
+		return nil, ErrInvalidIDToken
+	}
+
+	if time.Now().Unix() >= registered.Exp {
+		return nil, ErrInvalidIDToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	if claims.Subject == "" {
+		return nil, ErrInvalidIDToken
+	}
+
+	return &claims, nil
+}
+
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+
+	if keys != nil {
+		if k, ok := keys.keys[kid]; ok {
+			return k, nil
+		}
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	k, ok := keys.keys[kid]
+	if !ok {
+		return nil, ErrInvalidIDToken
+	}
+
+	return k, nil
+}
+
+func (p *Provider) fetchKeys(ctx context.Context) (*keySet, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := &keySet{keys: make(map[string]crypto.PublicKey)}
+	for _, k := range set.Keys {
+		if pub, err := k.publicKey(); err == nil {
+			keys.keys[k.Kid] = pub
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, ErrInvalidIDToken
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, ErrInvalidIDToken
+	}
+}
+
+// audience accepts both forms of the aud claim: a string or an array.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
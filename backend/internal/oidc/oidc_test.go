@@ -0,0 +1,267 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gratefulness-app/grace/internal/oidc"
+	"github.com/gratefulness-app/grace/internal/oidc/oidctest"
+)
+
+var jane = oidctest.Identity{
+	Subject:       "1234",
+	Email:         "jane@example.com",
+	EmailVerified: true,
+	Name:          "Jane",
+}
+
+// flow runs the authorization code flow for the identity and returns the
+// result of exchanging the code.
+func flow(t *testing.T, server *oidctest.Server, provider *oidc.Provider, identity oidctest.Identity) (*oidc.Claims, error) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	nonce, verifier := random(t), random(t)
+
+	authURL, err := provider.AuthCodeURL(ctx, random(t), nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := server.Authorize(t, authURL, identity)
+
+	return provider.Exchange(ctx, code, verifier, nonce)
+}
+
+func random(t *testing.T) string {
+	t.Helper()
+
+	s, err := oidc.RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	server := oidctest.NewServer(t)
+	provider := oidc.NewProvider(server.Config("test"))
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "the-state", "the-nonce", "the-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := u.Scheme + "://" + u.Host + u.Path; got != server.URL+"/authorize" {
+		t.Errorf("authorization endpoint = %s", got)
+	}
+
+	sum := sha256.Sum256([]byte("the-verifier"))
+
+	q := u.Query()
+	for key, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             oidctest.ClientID,
+		"redirect_uri":          oidctest.RedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(sum[:]),
+		"code_challenge_method": "S256",
+	} {
+		if got := q.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	// the verifier itself never leaves the server
+	if strings.Contains(authURL, "the-verifier") {
+		t.Error("authorization url contains the code verifier")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	server := oidctest.NewServer(t)
+	provider := oidc.NewProvider(server.Config("test"))
+
+	claims, err := flow(t, server, provider, jane)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Subject != jane.Subject || claims.Email != jane.Email || !claims.EmailVerified || claims.Name != jane.Name {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	if n := server.UserinfoRequests(); n != 0 {
+		t.Errorf("userinfo was requested %d times although the ID token had the email", n)
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(claims map[string]any)
+		forge  bool
+		want   error
+	}{
+		{"wrong issuer", func(c map[string]any) { c["iss"] = "https://evil.example.com" }, false, oidc.ErrInvalidIDToken},
+		{"wrong audience", func(c map[string]any) { c["aud"] = "someone-else" }, false, oidc.ErrInvalidIDToken},
+		{"expired", func(c map[string]any) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, false, oidc.ErrInvalidIDToken},
+		{"no subject", func(c map[string]any) { delete(c, "sub") }, false, oidc.ErrInvalidIDToken},
+		{"nonce mismatch", func(c map[string]any) { c["nonce"] = "replayed" }, false, oidc.ErrNonceMismatch},
+		{"no nonce", func(c map[string]any) { delete(c, "nonce") }, false, oidc.ErrNonceMismatch},
+		{"forged signature", nil, true, oidc.ErrInvalidIDToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := oidctest.NewServer(t)
+			server.TamperIDToken = tt.tamper
+			server.ForgeSignature = tt.forge
+
+			provider := oidc.NewProvider(server.Config("test"))
+
+			claims, err := flow(t, server, provider, jane)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got claims %+v and error %v, want %v", claims, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeAudienceArray(t *testing.T) {
+	server := oidctest.NewServer(t)
+	server.TamperIDToken = func(c map[string]any) { c["aud"] = []string{"other", oidctest.ClientID} }
+
+	provider := oidc.NewProvider(server.Config("test"))
+
+	if _, err := flow(t, server, provider, jane); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExchangeCode(t *testing.T) {
+	server := oidctest.NewServer(t)
+	provider := oidc.NewProvider(server.Config("test"))
+	ctx := context.Background()
+
+	nonce, verifier := random(t), random(t)
+
+	authURL, err := provider.AuthCodeURL(ctx, random(t), nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := server.Authorize(t, authURL, jane)
+
+	// PKCE: without the right verifier a stolen code is useless
+	if _, err := provider.Exchange(ctx, code, random(t), nonce); err == nil {
+		t.Fatal("exchange with the wrong verifier succeeded")
+	}
+
+	code, _ = server.Authorize(t, authURL, jane)
+
+	if _, err := provider.Exchange(ctx, code, verifier, nonce); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.Exchange(ctx, code, verifier, nonce); err == nil {
+		t.Fatal("a code was redeemed twice")
+	}
+
+	if _, err := provider.Exchange(ctx, "made-up", verifier, nonce); err == nil {
+		t.Fatal("exchange of an unknown code succeeded")
+	}
+}
+
+func TestExchangeUserinfo(t *testing.T) {
+	identity := jane
+	identity.UserinfoOnly = true
+
+	t.Run("fills in the profile", func(t *testing.T) {
+		server := oidctest.NewServer(t)
+		provider := oidc.NewProvider(server.Config("test"))
+
+		claims, err := flow(t, server, provider, identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if claims.Email != jane.Email || !claims.EmailVerified || claims.Name != jane.Name {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+
+		if n := server.UserinfoRequests(); n != 1 {
+			t.Errorf("userinfo was requested %d times, want 1", n)
+		}
+	})
+
+	t.Run("unverified email", func(t *testing.T) {
+		server := oidctest.NewServer(t)
+		server.TamperUserinfo = func(c map[string]any) { c["email_verified"] = false }
+
+		provider := oidc.NewProvider(server.Config("test"))
+
+		claims, err := flow(t, server, provider, identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if claims.EmailVerified {
+			t.Error("email reported as verified")
+		}
+	})
+
+	t.Run("different subject", func(t *testing.T) {
+		server := oidctest.NewServer(t)
+		server.TamperUserinfo = func(c map[string]any) { c["sub"] = "someone-else" }
+
+		provider := oidc.NewProvider(server.Config("test"))
+
+		if _, err := flow(t, server, provider, identity); !errors.Is(err, oidc.ErrSubjectChanged) {
+			t.Fatalf("got %v, want %v", err, oidc.ErrSubjectChanged)
+		}
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	server := oidctest.NewServer(t)
+	provider := oidc.NewProvider(server.Config("test"))
+
+	if _, err := flow(t, server, provider, jane); err != nil {
+		t.Fatal(err)
+	}
+
+	// tokens signed with a kid the provider hasn't seen make it refetch keys
+	server.RotateKey()
+
+	if _, err := flow(t, server, provider, jane); err != nil {
+		t.Fatalf("after key rotation: %v", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	server := oidctest.NewServer(t)
+
+	cfg := server.Config("test")
+	cfg.Issuer += "/"
+
+	provider := oidc.NewProvider(cfg)
+
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Fatal("discovery accepted a different issuer")
+	}
+}
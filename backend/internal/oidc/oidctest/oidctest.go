@@ -0,0 +1,310 @@
+// Package oidctest runs a stub OpenID Connect provider for tests. It signs
+// ID tokens with its own RSA key and implements discovery, the JWKS, the
+// authorization code flow with PKCE and the userinfo endpoint.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gratefulness-app/grace/internal/oidc"
+)
+
+const (
+	ClientID     = "grace-test"
+	ClientSecret = "grace-test-secret"
+	RedirectURL  = "http://localhost:3000/login/oidc/test"
+)
+
+// Identity is the account a user signs in to the provider with.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	// UserinfoOnly leaves the profile out of the ID token, so it can only
+	// be read from the userinfo endpoint.
+	UserinfoOnly bool
+}
+
+type grant struct {
+	identity    Identity
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+// Server is a running stub provider. The Tamper hooks change what the
+// provider answers with, to test how a misbehaving provider is handled.
+type Server struct {
+	*httptest.Server
+
+	// TamperIDToken edits the claims of every ID token before it's signed
+	TamperIDToken func(claims map[string]any)
+	// TamperUserinfo edits every userinfo response
+	TamperUserinfo func(claims map[string]any)
+	// ForgeSignature signs ID tokens with a key that isn't in the JWKS, under
+	// the kid of the published one
+	ForgeSignature bool
+
+	mu               sync.Mutex
+	key              *rsa.PrivateKey
+	kid              int
+	codes            map[string]grant
+	accessTokens     map[string]Identity
+	userinfoRequests int
+}
+
+// NewServer starts a provider that is shut down with the test.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{
+		codes:        make(map[string]grant),
+		accessTokens: make(map[string]Identity),
+	}
+	s.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("POST /token", s.token)
+	mux.HandleFunc("GET /userinfo", s.userinfo)
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Config configures an oidc.Provider for this server.
+func (s *Server) Config(name string) oidc.Config {
+	return oidc.Config{
+		Name:         name,
+		Issuer:       s.URL,
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		RedirectURL:  RedirectURL,
+	}
+}
+
+// RotateKey replaces the signing key with a new one under a new kid.
+func (s *Server) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.key = key
+	s.kid++
+}
+
+// UserinfoRequests is how often the userinfo endpoint was called.
+func (s *Server) UserinfoRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.userinfoRequests
+}
+
+// Authorize plays the user signing in with the identity at the
+// authorization URL. It returns the code and state the provider redirects
+// back with.
+func (s *Server) Authorize(t testing.TB, authURL string, identity Identity) (string, string) {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("oidctest: invalid authorization url: %v", err)
+	}
+
+	q := u.Query()
+	if q.Get("client_id") != ClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("oidctest: unexpected authorization request %s", authURL)
+	}
+
+	code := randomString()
+
+	s.mu.Lock()
+	s.codes[code] = grant{
+		identity:    identity,
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		redirectURI: q.Get("redirect_uri"),
+	}
+	s.mu.Unlock()
+
+	return code, q.Get("state")
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"userinfo_endpoint":      s.URL + "/userinfo",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	pub := s.key.PublicKey
+	kid := s.kid
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kid": fmt.Sprint(kid),
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+
+	s.mu.Lock()
+	g, ok := s.codes[code]
+	delete(s.codes, code) // codes are single-use
+	s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code",
+		r.PostForm.Get("client_id") != ClientID,
+		r.PostForm.Get("client_secret") != ClientSecret:
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	case !ok, challenge != g.challenge, r.PostForm.Get("redirect_uri") != g.redirectURI:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss":   s.URL,
+		"aud":   ClientID,
+		"sub":   g.identity.Subject,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Minute * 5).Unix(),
+		"nonce": g.nonce,
+	}
+
+	if !g.identity.UserinfoOnly {
+		claims["email"] = g.identity.Email
+		claims["email_verified"] = g.identity.EmailVerified
+		claims["name"] = g.identity.Name
+	}
+
+	if s.TamperIDToken != nil {
+		s.TamperIDToken(claims)
+	}
+
+	accessToken := randomString()
+
+	s.mu.Lock()
+	s.accessTokens[accessToken] = g.identity
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     s.sign(claims),
+	})
+}
+
+func (s *Server) userinfo(w http.ResponseWriter, r *http.Request) {
+	accessToken, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	s.mu.Lock()
+	s.userinfoRequests++
+	identity, ok := s.accessTokens[accessToken]
+	s.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	claims := map[string]any{
+		"sub":            identity.Subject,
+		"email":          identity.Email,
+		"email_verified": identity.EmailVerified,
+		"name":           identity.Name,
+	}
+
+	if s.TamperUserinfo != nil {
+		s.TamperUserinfo(claims)
+	}
+
+	writeJSON(w, http.StatusOK, claims)
+}
+
+// sign returns an RS256 JWT of the claims.
+func (s *Server) sign(claims map[string]any) string {
+	s.mu.Lock()
+	key, kid := s.key, s.kid
+	s.mu.Unlock()
+
+	if s.ForgeSignature {
+		forged, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+		key = forged
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": fmt.Sprint(kid)})
+	payload, _ := json.Marshal(claims)
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func randomString() string {
+	s, err := oidc.RandomString()
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
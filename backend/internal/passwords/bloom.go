@@ -0,0 +1,93 @@
+package passwords
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+var errInvalidBloom = errors.New("passwords: invalid bloom filter")
+
+// BloomFilter is a fixed-size set membership test. It never misses an added
+// item but may report items that were never added, at a rate chosen when the
+// filter is sized.
+type BloomFilter struct {
+	k    uint32 // number of hash functions
+	bits []byte
+}
+
+// NewBloomFilter sizes a filter for n items and a false positive rate of p.
+func NewBloomFilter(n int, p float64) *BloomFilter {
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(n) * math.Ln2)
+
+	return &BloomFilter{
+		k:    uint32(max(k, 1)),
+		bits: make([]byte, int(m+7)/8),
+	}
+}
+
+func (b *BloomFilter) Add(item string) {
+	for _, i := range b.indexes(item) {
+		b.bits[i/8] |= 1 << (i % 8)
+	}
+}
+
+func (b *BloomFilter) Has(item string) bool {
+	for _, i := range b.indexes(item) {
+		if b.bits[i/8]&(1<<(i%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// indexes derives the k bit positions of item by remixing a single FNV
+// hash with a different offset for each position. Plain double hashing
+// (h1 + i*h2) noticeably raises the false positive rate of small filters.
+func (b *BloomFilter) indexes(item string) []uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	sum := h.Sum64()
+
+	m := uint64(len(b.bits)) * 8
+
+	indexes := make([]uint64, b.k)
+	for i := range indexes {
+		indexes[i] = mix(sum+uint64(i)*0x9e3779b97f4a7c15) % m
+	}
+	return indexes
+}
+
+// mix is the splitmix64 finalizer.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// MarshalBinary encodes the filter as k (4 bytes, big endian) followed by the
+// bit set.
+func (b *BloomFilter) MarshalBinary() ([]byte, error) {
+	data := binary.BigEndian.AppendUint32(nil, b.k)
+	return append(data, b.bits...), nil
+}
+
+func (b *BloomFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < 5 {
+		return errInvalidBloom
+	}
+
+	b.k = binary.BigEndian.Uint32(data)
+	b.bits = append([]byte(nil), data[4:]...)
+
+	if b.k == 0 {
+		return errInvalidBloom
+	}
+
+	return nil
+}
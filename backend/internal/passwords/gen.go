@@ -0,0 +1,47 @@
+//go:build ignore
+
+// gen builds common.bloom from the password list in common.txt. Run it with
+// go generate after changing the list.
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gratefulness-app/grace/internal/passwords"
+)
+
+func main() {
+	f, err := os.Open("common.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	var list []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			list = append(list, strings.ToLower(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	filter := passwords.NewBloomFilter(len(list), 1e-6)
+	for _, password := range list {
+		filter.Add(password)
+	}
+
+	data, err := filter.MarshalBinary()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile("common.bloom", data, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,120 @@
+// Package passwords decides whether a password is strong enough to be set on
+// an account.
+package passwords
+
+import (
+	_ "embed"
+	"errors"
+	"math"
+	"strings"
+	"unicode"
+)
+
+//go:generate go run gen.go
+
+var (
+	ErrCommon          = errors.New("is too common")
+	ErrPersonalInfo    = errors.New("must not contain your username or email")
+	ErrTooPredictable  = errors.New("is too predictable, use a longer mix of characters")
+	minEntropy         = 28.0 // bits, see entropy
+	minPersonalInfoLen = 3    // shorter usernames would reject too many passwords
+)
+
+//go:embed common.bloom
+var commonBloom []byte
+
+var common = func() *BloomFilter {
+	var filter BloomFilter
+	if err := filter.UnmarshalBinary(commonBloom); err != nil {
+		panic(err)
+	}
+	return &filter
+}()
+
+// Check returns the first rule the password breaks, or nil if it is fine.
+// personal lists what the password must not contain, like the username and
+// email of the account.
+func Check(password string, personal ...string) error {
+	lower := strings.ToLower(password)
+
+	if common.Has(lower) {
+		return ErrCommon
+	}
+
+	for _, info := range personal {
+		for _, part := range personalParts(info) {
+			if len(part) >= minPersonalInfoLen && strings.Contains(lower, part) {
+				return ErrPersonalInfo
+			}
+		}
+	}
+
+	if entropy(password) < minEntropy {
+		return ErrTooPredictable
+	}
+
+	return nil
+}
+
+// personalParts splits an email into its local part and domain name so
+// neither can be reused, and returns anything else as is.
+func personalParts(info string) []string {
+	info = strings.ToLower(info)
+
+	local, domain, ok := strings.Cut(info, "@")
+	if !ok {
+		return []string{info}
+	}
+
+	name, _, _ := strings.Cut(domain, ".")
+	return []string{local, name}
+}
+
+// entropy estimates the strength of a password in bits. Every character
+// adds the bits of the character classes used in the password, except those
+// that repeat an earlier character or continue a run like "abc" or "321",
+// which add nothing. Padding a weak password doesn't make it strong.
+func entropy(password string) float64 {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if other {
+		pool += 33
+	}
+
+	perChar := math.Log2(float64(max(pool, 2)))
+
+	var bits float64
+	seen := make(map[rune]bool)
+	prev := rune(-1)
+	for _, r := range password {
+		if !seen[r] && r != prev+1 && r != prev-1 {
+			bits += perChar
+		}
+		seen[r] = true
+		prev = r
+	}
+
+	return bits
+}
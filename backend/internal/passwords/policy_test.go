@@ -0,0 +1,130 @@
+package passwords
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		personal []string
+		want     error
+	}{
+		{"passphrase", "correct horse battery staple", nil, nil},
+		{"mixed", "tK9#vLq2!mZ", nil, nil},
+		{"common", "password123", nil, ErrCommon},
+		{"common in another case", "PassWord123", nil, ErrCommon},
+		{"repeated character", strings.Repeat("a", 25), nil, ErrTooPredictable},
+		{"repeated digits", strings.Repeat("1234567890", 3), nil, ErrTooPredictable},
+		{"repeated word", strings.Repeat("grace", 6), nil, ErrTooPredictable},
+		{"alphabet", "abcdefghijklmnopqrstuvwxyz", nil, ErrTooPredictable},
+		{"countdown", "zyxwvutsrqponmlkjihgfedcba9876543210", nil, ErrTooPredictable},
+		{"short", "tK9#", nil, ErrTooPredictable},
+		{"username", "xx-janedoe-tK9#vLq2!mZ", []string{"janedoe", "jane@example.com"}, ErrPersonalInfo},
+		{"email local part", "tK9#vLq2!mZ-JANE", []string{"janedoe", "jane@example.com"}, ErrPersonalInfo},
+		{"email domain", "tK9#vLq2!mZexample", []string{"janedoe", "jane@example.com"}, ErrPersonalInfo},
+		{"short username", "tK9#vLq2!mZ-al", []string{"al"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Check(tt.password, tt.personal...); err != tt.want {
+				t.Errorf("Check(%q) = %v, want %v", tt.password, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	tests := []struct {
+		password string
+		want     float64
+	}{
+		{"", 0},
+		{"a", math.Log2(26)},
+		{strings.Repeat("a", 25), math.Log2(26)}, // repeats add nothing
+		{"abcdef", math.Log2(26)},                // neither do runs
+		{"fedcba", math.Log2(26)},                // in either direction
+		{strings.Repeat("1234567890", 3), 2 * math.Log2(10)}, // the run breaks at 0 once
+		{"aZ", 2 * math.Log2(52)},                            // lower and upper
+		{"a1!", 3 * math.Log2(69)},                           // lower, digit and other
+	}
+
+	for _, tt := range tests {
+		if got := entropy(tt.password); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("entropy(%q) = %.2f, want %.2f", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestPersonalParts(t *testing.T) {
+	tests := []struct {
+		info string
+		want []string
+	}{
+		{"JaneDoe", []string{"janedoe"}},
+		{"Jane@Example.com", []string{"jane", "example"}},
+		{"jane@mail.example.co.uk", []string{"jane", "mail"}},
+	}
+
+	for _, tt := range tests {
+		got := personalParts(tt.info)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("personalParts(%q) = %q, want %q", tt.info, got, tt.want)
+		}
+	}
+}
+
+func TestCommonList(t *testing.T) {
+	f, err := os.Open("common.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// the filter must never miss a listed password, or it's out of date
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.ToLower(strings.TrimSpace(scanner.Text())); line != "" && !common.Has(line) {
+			t.Fatalf("%q is listed but not in common.bloom, run go generate", line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	filter := NewBloomFilter(1000, 0.001)
+
+	for i := range 1000 {
+		filter.Add(strings.Repeat("x", i%10) + string(rune('a'+i%26)) + string(rune('A'+i/26)))
+	}
+
+	var restored BloomFilter
+	data, err := filter.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 1000 {
+		item := strings.Repeat("x", i%10) + string(rune('a'+i%26)) + string(rune('A'+i/26))
+		if !restored.Has(item) {
+			t.Fatalf("restored filter lost %q", item)
+		}
+	}
+
+	if err := restored.UnmarshalBinary([]byte{1, 2}); err == nil {
+		t.Fatal("truncated filter was accepted")
+	}
+}
@@ -18,7 +18,7 @@ type BadgeStore struct {
 
 func (s *BadgeStore) GetByID(ctx context.Context, id int64) (*Badge, error) {
 	query := `
-		SELECT id, title, description, icon
+		SELECT id, name, description, image_url
 		FROM badges
 		WHERE id = $1
 	`
@@ -48,7 +48,7 @@ func (s *BadgeStore) GetByID(ctx context.Context, id int64) (*Badge, error) {
 
 func (s *BadgeStore) Create(ctx context.Context, tx *sql.Tx, badge *Badge) error {
 	query := `
-		INSERT INTO badges (title, description, icon)
+		INSERT INTO badges (name, description, image_url)
 		VALUES ($1, $2, $3)
 		RETURNING id
 	`
@@ -71,11 +71,18 @@ func (s *BadgeStore) Create(ctx context.Context, tx *sql.Tx, badge *Badge) error
 	return nil
 }
 
+// Add creates a badge in its own transaction.
+func (s *BadgeStore) Add(ctx context.Context, badge *Badge) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.Create(ctx, tx, badge)
+	})
+}
+
 func (s *BadgeStore) ListAll(ctx context.Context) ([]*Badge, error) {
 	query := `
-		SELECT id, title, description, icon
+		SELECT id, name, description, image_url
 		FROM badges
-		ORDER BY title
+		ORDER BY name
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var ErrBlocked = errors.New("one of the users has blocked the other")
+
+// BlockStore keeps track of the users each user blocked. A block works both
+// ways: neither user can befriend, follow or send cards to the other.
+type BlockStore struct {
+	db *sql.DB
+}
+
+// Block blocks the user and severs every friend and follower relationship
+// between the two, in either direction
+func (s *BlockStore) Block(ctx context.Context, userID, blockedID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := lockUserPair(ctx, tx, userID, blockedID); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			INSERT INTO blocks (user_id, blocked_id)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id, blocked_id) DO NOTHING
+		`
+		if _, err := tx.ExecContext(ctx, query, userID, blockedID); err != nil {
+			return err
+		}
+
+		query = `
+			DELETE FROM friends
+			WHERE (user_id = $1 AND friend_id = $2) OR (user_id = $2 AND friend_id = $1)
+		`
+		if _, err := tx.ExecContext(ctx, query, userID, blockedID); err != nil {
+			return err
+		}
+
+		query = `
+			DELETE FROM followers
+			WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+		`
+		if _, err := tx.ExecContext(ctx, query, userID, blockedID); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// lockUserPair locks both users' rows until the transaction ends. Blocking
+// and befriending or following take it before touching the pair, so neither
+// can miss the other's uncommitted rows. Rows are locked in id order to avoid
+// deadlocks.
+func lockUserPair(ctx context.Context, tx *sql.Tx, userID, otherID int64) error {
+	query := `
+		SELECT id FROM users
+		WHERE id IN ($1, $2)
+		ORDER BY id
+		FOR NO KEY UPDATE
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID, otherID)
+	return err
+}
+
+// Unblock lifts the block. The severed relationships aren't restored.
+func (s *BlockStore) Unblock(ctx context.Context, userID, blockedID int64) error {
+	query := `
+		DELETE FROM blocks
+		WHERE user_id = $1 AND blocked_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetByUserID lists the users the user blocked, most recent first
+func (s *BlockStore) GetByUserID(ctx context.Context, userID int64, limit, offset int) ([]*User, error) {
+	query := `
+		SELECT u.id, u.username, u.created_at
+		FROM users u
+		INNER JOIN blocks b ON b.blocked_id = u.id
+		WHERE b.user_id = $1 AND u.purge_at IS NULL
+		ORDER BY b.created_at DESC, u.id
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// IsBlocked reports whether either user blocked the other
+func (s *BlockStore) IsBlocked(ctx context.Context, userID, otherID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (user_id = $1 AND blocked_id = $2) OR (user_id = $2 AND blocked_id = $1)
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var blocked bool
+	if err := s.db.QueryRowContext(ctx, query, userID, otherID).Scan(&blocked); err != nil {
+		return false, err
+	}
+
+	return blocked, nil
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
@@ -13,7 +14,7 @@ type Card struct {
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 	TemplateId int64     `json:"template_id"`
-	UserId     int64     `json:"user_id"`
+	UserId     *int64    `json:"user_id"` // nil once the sender's account was purged
 }
 
 type CardStore struct {
@@ -31,10 +32,11 @@ func (s *CardStore) GetByID(ctx context.Context, id int64) (*Card, error) {
 	defer cancel()
 
 	var card Card
+	var data []byte
 	err := s.db.QueryRowContext(ctx, query, id).Scan(
 		&card.ID,
 		&card.Title,
-		&card.Data,
+		&data,
 		&card.CreatedAt,
 		&card.UpdatedAt,
 		&card.TemplateId,
@@ -50,6 +52,9 @@ func (s *CardStore) GetByID(ctx context.Context, id int64) (*Card, error) {
 		}
 	}
 
+	// JSONB is read as bytes, which would otherwise be encoded as base64
+	card.Data = json.RawMessage(data)
+
 	return &card, nil
 }
 
@@ -60,14 +65,20 @@ func (s *CardStore) Create(ctx context.Context, tx *sql.Tx, card *Card) error {
 		RETURNING id, created_at, updated_at
 	`
 
+	// a []byte would be sent as bytea, which isn't valid JSON
+	data, err := json.Marshal(card.Data)
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := tx.QueryRowContext(
+	err = tx.QueryRowContext(
 		ctx,
 		query,
 		card.Title,
-		card.Data,
+		string(data),
 		card.TemplateId,
 		card.UserId,
 	).Scan(
@@ -83,6 +94,52 @@ func (s *CardStore) Create(ctx context.Context, tx *sql.Tx, card *Card) error {
 	return nil
 }
 
+// Send creates the card and delivers it to the recipient's notifications. It
+// returns ErrBlocked without creating anything when either user blocked the
+// other. Cards from a sender the recipient muted are delivered already read,
+// and the returned bool, whether to notify the recipient, is false.
+func (s *CardStore) Send(ctx context.Context, card *Card, recipientID int64) (bool, error) {
+	var muted bool
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.Create(ctx, tx, card); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO notifications (card_id, user_id, read)
+			SELECT $1::bigint, $2::bigint, EXISTS (
+				SELECT 1 FROM mutes WHERE user_id = $2 AND muted_id = $3
+			)
+			WHERE NOT EXISTS (
+				SELECT 1 FROM blocks
+				WHERE (user_id = $2 AND blocked_id = $3) OR (user_id = $3 AND blocked_id = $2)
+			)
+			RETURNING read
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, card.ID, recipientID, card.UserId).Scan(&muted)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrBlocked
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return !muted, nil
+}
+
 func (s *CardStore) GetByUserID(ctx context.Context, userID int64, limit, offset int) ([]*Card, error) {
 	query := `
 		SELECT id, title, data, created_at, updated_at, template_id, user_id
@@ -101,14 +158,42 @@ func (s *CardStore) GetByUserID(ctx context.Context, userID int64, limit, offset
 	}
 	defer rows.Close()
 
+	return scanCards(rows)
+}
+
+// GetReceivedByUserID lists the cards delivered to the user, newest first
+func (s *CardStore) GetReceivedByUserID(ctx context.Context, userID int64, limit, offset int) ([]*Card, error) {
+	query := `
+		SELECT c.id, c.title, c.data, c.created_at, c.updated_at, c.template_id, c.user_id
+		FROM cards c
+		INNER JOIN notifications n ON n.card_id = c.id
+		WHERE n.user_id = $1
+		ORDER BY n.created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanCards(rows)
+}
+
+func scanCards(rows *sql.Rows) ([]*Card, error) {
 	cards := []*Card{}
 
 	for rows.Next() {
 		var card Card
+		var data []byte
 		err := rows.Scan(
 			&card.ID,
 			&card.Title,
-			&card.Data,
+			&data,
 			&card.CreatedAt,
 			&card.UpdatedAt,
 			&card.TemplateId,
@@ -117,10 +202,11 @@ func (s *CardStore) GetByUserID(ctx context.Context, userID int64, limit, offset
 		if err != nil {
 			return nil, err
 		}
+		card.Data = json.RawMessage(data)
 		cards = append(cards, &card)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,248 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrExportInProgress = errors.New("an export of your data is already in progress")
+
+// Data export statuses
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// DataExport is an archive of everything a user has on Grace. The archive
+// can be downloaded with the token emailed once it is ready.
+type DataExport struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Status      string     `json:"status"`
+	Archive     []byte     `json:"-"`
+	Size        int64      `json:"size"` // of the archive in bytes
+	ExpiresAt   time.Time  `json:"expires_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type DataExportStore struct {
+	db *sql.DB
+}
+
+func (s *DataExportStore) Create(ctx context.Context, export *DataExport) error {
+	query := `
+		INSERT INTO data_exports (user_id, expires_at)
+		VALUES ($1, $2)
+		RETURNING id, status, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		export.UserID,
+		export.ExpiresAt,
+	).Scan(
+		&export.ID,
+		&export.Status,
+		&export.CreatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "idx_data_exports_pending"`:
+			return ErrExportInProgress
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetByUserID lists the exports of a user, newest first, without their
+// archives
+func (s *DataExportStore) GetByUserID(ctx context.Context, userID int64) ([]*DataExport, error) {
+	query := `
+		SELECT id, user_id, status, size, expires_at, completed_at, created_at
+		FROM data_exports
+		WHERE user_id = $1 AND expires_at > $2
+		ORDER BY created_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := []*DataExport{}
+
+	for rows.Next() {
+		var export DataExport
+		err := rows.Scan(
+			&export.ID,
+			&export.UserID,
+			&export.Status,
+			&export.Size,
+			&export.ExpiresAt,
+			&export.CompletedAt,
+			&export.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, &export)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return exports, nil
+}
+
+// GetByToken returns a ready export with its archive
+func (s *DataExportStore) GetByToken(ctx context.Context, token string) (*DataExport, error) {
+	query := `
+		SELECT id, user_id, status, archive, size, expires_at, completed_at, created_at
+		FROM data_exports
+		WHERE token = $1 AND status = $2 AND expires_at > $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var export DataExport
+	err := s.db.QueryRowContext(ctx, query, token, ExportReady, time.Now()).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.Archive,
+		&export.Size,
+		&export.ExpiresAt,
+		&export.CompletedAt,
+		&export.CreatedAt,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &export, nil
+}
+
+// Complete stores the archive and the token it can be downloaded with until
+// the export expires.
+func (s *DataExportStore) Complete(ctx context.Context, export *DataExport, token string) error {
+	query := `
+		UPDATE data_exports
+		SET status = $1, archive = $2, size = $3, token = $4, expires_at = $5, completed_at = NOW()
+		WHERE id = $6
+		RETURNING status, completed_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		ExportReady,
+		export.Archive,
+		len(export.Archive),
+		token,
+		export.ExpiresAt,
+		export.ID,
+	).Scan(
+		&export.Status,
+		&export.CompletedAt,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	export.Size = int64(len(export.Archive))
+
+	return nil
+}
+
+// Fail marks an export that couldn't be built, so the user can request a
+// new one.
+func (s *DataExportStore) Fail(ctx context.Context, id int64) error {
+	query := `
+		UPDATE data_exports
+		SET status = $1, completed_at = NOW()
+		WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, ExportFailed, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FailStale marks the exports still pending from before the given time as
+// failed, when whatever built them died with the server, and returns how
+// many there were.
+func (s *DataExportStore) FailStale(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		UPDATE data_exports
+		SET status = $1, completed_at = NOW()
+		WHERE status = $2 AND created_at <= $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, ExportFailed, ExportPending, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// DeleteExpired deletes the exports that can't be downloaded anymore,
+// including any that never finished, and returns how many there were.
+func (s *DataExportStore) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `
+		DELETE FROM data_exports
+		WHERE expires_at <= $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -14,21 +14,39 @@ type FollowerStore struct {
 	db *sql.DB
 }
 
-// Create adds a new follower relationship
+// Create adds a new follower relationship, unless either user blocked the
+// other
 func (s *FollowerStore) Create(ctx context.Context, tx *sql.Tx, follower *Follower) error {
 	query := `
 		INSERT INTO followers (user_id, follower_id)
-		VALUES ($1, $2)
+		SELECT $1::bigint, $2::bigint
+		WHERE NOT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (user_id = $1 AND blocked_id = $2) OR (user_id = $2 AND blocked_id = $1)
+		)
 	`
 
+	if err := lockUserPair(ctx, tx, follower.UserId, follower.FollowerId); err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := tx.ExecContext(ctx, query, follower.UserId, follower.FollowerId)
+	result, err := tx.ExecContext(ctx, query, follower.UserId, follower.FollowerId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if rowsAffected == 0 {
+		return ErrBlocked
+	}
+
 	return nil
 }
 
@@ -67,7 +85,7 @@ func (s *FollowerStore) GetFollowers(ctx context.Context, userId int64, limit, o
 		SELECT u.id, u.username, u.email, u.verified, u.friend_hash, u.follower_hash, u.updated_at, u.created_at
 		FROM users u
 		INNER JOIN followers f ON f.follower_id = u.id
-		WHERE f.user_id = $1
+		WHERE f.user_id = $1 AND u.purge_at IS NULL
 		ORDER BY u.username
 		LIMIT $2 OFFSET $3
 	`
@@ -90,8 +108,8 @@ func (s *FollowerStore) GetFollowers(ctx context.Context, userId int64, limit, o
 			&user.Username,
 			&user.Email,
 			&user.Verified,
-			&user.FriendHash,
-			&user.FollowerHash,
+			&user.FriendHash.hash,
+			&user.FollowerHash.hash,
 			&user.UpdatedAt,
 			&user.CreatedAt,
 		)
@@ -114,7 +132,7 @@ func (s *FollowerStore) GetFollowing(ctx context.Context, followerId int64, limi
 		SELECT u.id, u.username, u.email, u.verified, u.friend_hash, u.follower_hash, u.updated_at, u.created_at
 		FROM users u
 		INNER JOIN followers f ON f.user_id = u.id
-		WHERE f.follower_id = $1
+		WHERE f.follower_id = $1 AND u.purge_at IS NULL
 		ORDER BY u.username
 		LIMIT $2 OFFSET $3
 	`
@@ -137,8 +155,8 @@ func (s *FollowerStore) GetFollowing(ctx context.Context, followerId int64, limi
 			&user.Username,
 			&user.Email,
 			&user.Verified,
-			&user.FriendHash,
-			&user.FollowerHash,
+			&user.FriendHash.hash,
+			&user.FollowerHash.hash,
 			&user.UpdatedAt,
 			&user.CreatedAt,
 		)
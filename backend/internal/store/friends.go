@@ -14,21 +14,38 @@ type FriendStore struct {
 	db *sql.DB
 }
 
-// Create adds a new friend relationship
+// Create adds a new friend relationship, unless either user blocked the other
 func (s *FriendStore) Create(ctx context.Context, tx *sql.Tx, friend *Friend) error {
 	query := `
 		INSERT INTO friends (user_id, friend_id)
-		VALUES ($1, $2)
+		SELECT $1::bigint, $2::bigint
+		WHERE NOT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (user_id = $1 AND blocked_id = $2) OR (user_id = $2 AND blocked_id = $1)
+		)
 	`
 
+	if err := lockUserPair(ctx, tx, friend.UserId, friend.FriendId); err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := tx.ExecContext(ctx, query, friend.UserId, friend.FriendId)
+	result, err := tx.ExecContext(ctx, query, friend.UserId, friend.FriendId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if rowsAffected == 0 {
+		return ErrBlocked
+	}
+
 	return nil
 }
 
@@ -67,7 +84,7 @@ func (s *FriendStore) GetByUserID(ctx context.Context, userId int64, limit, offs
 		SELECT u.id, u.username, u.email, u.verified, u.friend_hash, u.follower_hash, u.updated_at, u.created_at
 		FROM users u
 		INNER JOIN friends f ON f.friend_id = u.id
-		WHERE f.user_id = $1
+		WHERE f.user_id = $1 AND u.purge_at IS NULL
 		ORDER BY u.username
 		LIMIT $2 OFFSET $3
 	`
@@ -90,8 +107,8 @@ func (s *FriendStore) GetByUserID(ctx context.Context, userId int64, limit, offs
 			&user.Username,
 			&user.Email,
 			&user.Verified,
-			&user.FriendHash,
-			&user.FollowerHash,
+			&user.FriendHash.hash,
+			&user.FollowerHash.hash,
 			&user.UpdatedAt,
 			&user.CreatedAt,
 		)
@@ -0,0 +1,259 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrDuplicateIdentity = errors.New("this identity is already linked to an account")
+
+// Identity links an account at an external OpenID Connect provider to a user
+type Identity struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"` // provider's stable user id
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCState is the server side half of an in-flight authorization request
+type OIDCState struct {
+	State        string // sha256 hash of the state sent to the provider
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	UserID       int64 // user linking a new identity, 0 for a login
+	SessionID    int64 // session the link was started from, 0 for a login
+	ExpiresAt    time.Time
+}
+
+type IdentityStore struct {
+	db *sql.DB
+}
+
+// Create links a new identity within a transaction
+func (s *IdentityStore) Create(ctx context.Context, tx *sql.Tx, identity *Identity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+	).Scan(
+		&identity.ID,
+		&identity.CreatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "user_identities_provider_subject_key"`:
+			return ErrDuplicateIdentity
+		case err.Error() == `pq: duplicate key value violates unique constraint "user_identities_user_id_provider_key"`:
+			return ErrDuplicateIdentity
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Link links a new identity to an existing user in its own transaction
+func (s *IdentityStore) Link(ctx context.Context, identity *Identity) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.Create(ctx, tx, identity)
+	})
+}
+
+// GetBySubject retrieves the identity for a provider's user id
+func (s *IdentityStore) GetBySubject(ctx context.Context, provider, subject string) (*Identity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at
+		FROM user_identities
+		WHERE provider = $1 AND subject = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var identity Identity
+	err := s.db.QueryRowContext(ctx, query, provider, subject).Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &identity, nil
+}
+
+// GetByUserID retrieves all identities linked to a user
+func (s *IdentityStore) GetByUserID(ctx context.Context, userID int64) ([]*Identity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY provider
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*Identity{}
+
+	for rows.Next() {
+		var identity Identity
+		err := rows.Scan(
+			&identity.ID,
+			&identity.UserID,
+			&identity.Provider,
+			&identity.Subject,
+			&identity.Email,
+			&identity.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, &identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// Delete unlinks one of the user's identities
+func (s *IdentityStore) Delete(ctx context.Context, id, userID int64) error {
+	query := `
+		DELETE FROM user_identities
+		WHERE id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CreateState stores an in-flight authorization request
+func (s *IdentityStore) CreateState(ctx context.Context, state *OIDCState) error {
+	query := `
+		INSERT INTO oidc_states (state, provider, nonce, code_verifier, user_id, session_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var userID, sessionID sql.NullInt64
+	if state.UserID != 0 {
+		userID = sql.NullInt64{Int64: state.UserID, Valid: true}
+	}
+	if state.SessionID != 0 {
+		sessionID = sql.NullInt64{Int64: state.SessionID, Valid: true}
+	}
+
+	_, err := s.db.ExecContext(
+		ctx,
+		query,
+		state.State,
+		state.Provider,
+		state.Nonce,
+		state.CodeVerifier,
+		userID,
+		sessionID,
+		state.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeState deletes and returns an unexpired authorization request, so a
+// state can only be redeemed once
+func (s *IdentityStore) ConsumeState(ctx context.Context, state, provider string) (*OIDCState, error) {
+	query := `
+		DELETE FROM oidc_states
+		WHERE state = $1 AND provider = $2 AND expires_at > $3
+		RETURNING state, provider, nonce, code_verifier, user_id, session_id, expires_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var (
+		oidcState         OIDCState
+		userID, sessionID sql.NullInt64
+	)
+	err := s.db.QueryRowContext(ctx, query, state, provider, time.Now()).Scan(
+		&oidcState.State,
+		&oidcState.Provider,
+		&oidcState.Nonce,
+		&oidcState.CodeVerifier,
+		&userID,
+		&sessionID,
+		&oidcState.ExpiresAt,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	oidcState.UserID = userID.Int64
+	oidcState.SessionID = sessionID.Int64
+
+	return &oidcState, nil
+}
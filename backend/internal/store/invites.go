@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrInvalidInviteCode = errors.New("invite code is invalid, used up or expired")
+
+type InviteCode struct {
+	ID        int64     `json:"id"`
+	Code      string    `json:"code"`
+	CreatedBy int64     `json:"created_by"`
+	MaxUses   int       `json:"max_uses"`
+	Uses      int       `json:"uses"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type InviteStore struct {
+	db *sql.DB
+}
+
+func (s *InviteStore) Create(ctx context.Context, invite *InviteCode) error {
+	query := `
+		INSERT INTO invite_codes (code, created_by, max_uses, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		invite.Code,
+		invite.CreatedBy,
+		invite.MaxUses,
+		invite.ExpiresAt,
+	).Scan(
+		&invite.ID,
+		&invite.CreatedAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetByCreator lists the codes a user generated, newest first
+func (s *InviteStore) GetByCreator(ctx context.Context, userID int64) ([]*InviteCode, error) {
+	query := `
+		SELECT id, code, created_by, max_uses, uses, expires_at, created_at
+		FROM invite_codes
+		WHERE created_by = $1
+		ORDER BY created_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []*InviteCode{}
+
+	for rows.Next() {
+		var invite InviteCode
+		err := rows.Scan(
+			&invite.ID,
+			&invite.Code,
+			&invite.CreatedBy,
+			&invite.MaxUses,
+			&invite.Uses,
+			&invite.ExpiresAt,
+			&invite.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, &invite)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invites, nil
+}
+
+// CountActiveByCreator counts the codes of a user that can still be used
+func (s *InviteStore) CountActiveByCreator(ctx context.Context, userID int64) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM invite_codes
+		WHERE created_by = $1 AND uses < max_uses AND expires_at > $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, query, userID, time.Now()).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Delete revokes a code so it can't be used anymore. Accounts created with
+// it keep their inviter.
+func (s *InviteStore) Delete(ctx context.Context, id, userID int64) error {
+	query := `
+		DELETE FROM invite_codes
+		WHERE id = $1 AND created_by = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// redeemInviteCode uses up one use of the code and returns who created it
+func redeemInviteCode(ctx context.Context, tx *sql.Tx, code string) (int64, error) {
+	query := `
+		UPDATE invite_codes
+		SET uses = uses + 1
+		WHERE code = $1 AND uses < max_uses AND expires_at > $2
+		RETURNING created_by
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var createdBy int64
+	err := tx.QueryRowContext(ctx, query, code, time.Now()).Scan(&createdBy)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return 0, ErrInvalidInviteCode
+		default:
+			return 0, err
+		}
+	}
+
+	return createdBy, nil
+}
+
+// releaseInviteCode gives back a use taken by redeemInviteCode
+func releaseInviteCode(ctx context.Context, tx *sql.Tx, code string) error {
+	query := `
+		UPDATE invite_codes
+		SET uses = uses - 1
+		WHERE code = $1 AND uses > 0
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := tx.ExecContext(ctx, query, code); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// FailedLogins summarises the failed login attempts of an account or an IP
+// address since some point in time.
+type FailedLogins struct {
+	Count int
+	Last  time.Time // most recent failure, zero when Count is 0
+}
+
+type LoginAttemptStore struct {
+	db *sql.DB
+}
+
+// Record stores a failed login attempt. userID is 0 when the attempt was for
+// an email that has no account, emailHash is empty when the attempt wasn't
+// for an email at all, so it only counts against the IP address.
+func (s *LoginAttemptStore) Record(ctx context.Context, userID int64, emailHash, ip string) error {
+	query := `
+		INSERT INTO login_attempts (user_id, email_hash, ip)
+		VALUES (NULLIF($1, 0), NULLIF($2, ''), $3)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, emailHash, ip)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FailuresByEmail counts the failures for an email, whether or not it has an
+// account.
+func (s *LoginAttemptStore) FailuresByEmail(ctx context.Context, emailHash string, since time.Time) (*FailedLogins, error) {
+	query := `
+		SELECT COUNT(*), MAX(created_at)
+		FROM login_attempts
+		WHERE email_hash = $1 AND created_at > $2
+	`
+
+	return s.failures(ctx, query, emailHash, since)
+}
+
+func (s *LoginAttemptStore) FailuresByIP(ctx context.Context, ip string, since time.Time) (*FailedLogins, error) {
+	query := `
+		SELECT COUNT(*), MAX(created_at)
+		FROM login_attempts
+		WHERE ip = $1 AND created_at > $2
+	`
+
+	return s.failures(ctx, query, ip, since)
+}
+
+func (s *LoginAttemptStore) failures(ctx context.Context, query string, key any, since time.Time) (*FailedLogins, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var failed FailedLogins
+	var last sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, key, since).Scan(&failed.Count, &last)
+	if err != nil {
+		return nil, err
+	}
+
+	failed.Last = last.Time
+
+	return &failed, nil
+}
+
+// Clear forgets the failed attempts of a user after they signed in.
+func (s *LoginAttemptStore) Clear(ctx context.Context, userID int64) error {
+	query := `
+		DELETE FROM login_attempts
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Lock locks the user out until the given time and stores the token that
+// lets them unlock the account early from the lockout email.
+func (s *LoginAttemptStore) Lock(ctx context.Context, userID int64, until time.Time, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE users
+			SET locked_until = $1
+			WHERE id = $2
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, query, until, userID); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO account_unlocks (token, user_id, expires_at)
+			VALUES ($1, $2, $3)
+		`
+
+		if _, err := tx.ExecContext(ctx, query, token, userID, time.Now().Add(exp)); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Unlock lifts the lockout the token was issued for and forgets the failed
+// attempts that caused it. It returns the id of the unlocked user.
+func (s *LoginAttemptStore) Unlock(ctx context.Context, token string) (int64, error) {
+	var userID int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			DELETE FROM account_unlocks
+			WHERE token = $1 AND expires_at > $2
+			RETURNING user_id
+		`
+
+		err := tx.QueryRowContext(ctx, query, token, time.Now()).Scan(&userID)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		query = `
+			UPDATE users
+			SET locked_until = NULL
+			WHERE id = $1
+		`
+
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+
+		query = `
+			DELETE FROM login_attempts
+			WHERE user_id = $1
+		`
+
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+
+		query = `
+			DELETE FROM account_unlocks
+			WHERE user_id = $1
+		`
+
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	return userID, err
+}
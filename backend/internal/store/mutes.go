@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// MuteStore keeps track of the users each user muted. Muting keeps every
+// relationship in place, cards from a muted user are still delivered but
+// arrive already read and without an email.
+type MuteStore struct {
+	db *sql.DB
+}
+
+// Mute mutes the user, muting them again is a no-op
+func (s *MuteStore) Mute(ctx context.Context, userID, mutedID int64) error {
+	query := `
+		INSERT INTO mutes (user_id, muted_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, muted_id) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, query, userID, mutedID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Unmute lifts the mute
+func (s *MuteStore) Unmute(ctx context.Context, userID, mutedID int64) error {
+	query := `
+		DELETE FROM mutes
+		WHERE user_id = $1 AND muted_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID, mutedID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetByUserID lists the users the user muted, most recent first
+func (s *MuteStore) GetByUserID(ctx context.Context, userID int64, limit, offset int) ([]*User, error) {
+	query := `
+		SELECT u.id, u.username, u.created_at
+		FROM users u
+		INNER JOIN mutes m ON m.muted_id = u.id
+		WHERE m.user_id = $1 AND u.purge_at IS NULL
+		ORDER BY m.created_at DESC, u.id
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
@@ -0,0 +1,276 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrDuplicatePasskey = errors.New("this passkey is already registered")
+
+const (
+	ChallengeRegistration   = "registration"
+	ChallengeAuthentication = "authentication"
+)
+
+// Passkey is a WebAuthn credential registered by a user
+type Passkey struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"`
+	CredentialID []byte     `json:"-"`
+	PublicKey    []byte     `json:"-"` // COSE_Key
+	SignCount    uint32     `json:"-"`
+	Name         string     `json:"name"` // friendly name, e.g. "iPhone"
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// WebAuthnChallenge is a pending registration or sign-in ceremony
+type WebAuthnChallenge struct {
+	Challenge string // sha256 hash of the challenge sent to the browser
+	Type      string
+	UserID    int64 // user registering a passkey, 0 for a sign-in
+	ExpiresAt time.Time
+}
+
+type PasskeyStore struct {
+	db *sql.DB
+}
+
+// Create adds a new passkey within a transaction
+func (s *PasskeyStore) Create(ctx context.Context, tx *sql.Tx, passkey *Passkey) error {
+	query := `
+		INSERT INTO passkeys (user_id, credential_id, public_key, sign_count, name)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		passkey.UserID,
+		passkey.CredentialID,
+		passkey.PublicKey,
+		int64(passkey.SignCount),
+		passkey.Name,
+	).Scan(
+		&passkey.ID,
+		&passkey.CreatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "passkeys_credential_id_key"`:
+			return ErrDuplicatePasskey
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Register adds a new passkey in its own transaction
+func (s *PasskeyStore) Register(ctx context.Context, passkey *Passkey) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.Create(ctx, tx, passkey)
+	})
+}
+
+// GetByCredentialID retrieves a passkey by the authenticator's credential id
+func (s *PasskeyStore) GetByCredentialID(ctx context.Context, credentialID []byte) (*Passkey, error) {
+	query := `
+		SELECT id, user_id, credential_id, public_key, sign_count, name, last_used_at, created_at
+		FROM passkeys
+		WHERE credential_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	passkey, err := scanPasskey(s.db.QueryRowContext(ctx, query, credentialID))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return passkey, nil
+}
+
+// GetByUserID retrieves all passkeys of a user
+func (s *PasskeyStore) GetByUserID(ctx context.Context, userID int64) ([]*Passkey, error) {
+	query := `
+		SELECT id, user_id, credential_id, public_key, sign_count, name, last_used_at, created_at
+		FROM passkeys
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passkeys := []*Passkey{}
+
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, passkey)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return passkeys, nil
+}
+
+// UpdateSignCount records a successful sign-in with the passkey
+func (s *PasskeyStore) UpdateSignCount(ctx context.Context, id int64, signCount uint32) error {
+	query := `
+		UPDATE passkeys
+		SET sign_count = $1, last_used_at = NOW()
+		WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, int64(signCount), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes one of the user's passkeys
+func (s *PasskeyStore) Delete(ctx context.Context, id, userID int64) error {
+	query := `
+		DELETE FROM passkeys
+		WHERE id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CreateChallenge stores a pending ceremony
+func (s *PasskeyStore) CreateChallenge(ctx context.Context, challenge *WebAuthnChallenge) error {
+	query := `
+		INSERT INTO webauthn_challenges (challenge, type, user_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var userID sql.NullInt64
+	if challenge.UserID != 0 {
+		userID = sql.NullInt64{Int64: challenge.UserID, Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, query, challenge.Challenge, challenge.Type, userID, challenge.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeChallenge deletes and returns an unexpired ceremony of the given
+// type, so every challenge can only be answered once
+func (s *PasskeyStore) ConsumeChallenge(ctx context.Context, challenge, typ string) (*WebAuthnChallenge, error) {
+	query := `
+		DELETE FROM webauthn_challenges
+		WHERE challenge = $1 AND type = $2 AND expires_at > $3
+		RETURNING challenge, type, user_id, expires_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var (
+		c      WebAuthnChallenge
+		userID sql.NullInt64
+	)
+	err := s.db.QueryRowContext(ctx, query, challenge, typ, time.Now()).Scan(
+		&c.Challenge,
+		&c.Type,
+		&userID,
+		&c.ExpiresAt,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	c.UserID = userID.Int64
+
+	return &c, nil
+}
+
+func scanPasskey(row interface{ Scan(...any) error }) (*Passkey, error) {
+	var (
+		passkey    Passkey
+		signCount  int64
+		lastUsedAt sql.NullTime
+	)
+
+	err := row.Scan(
+		&passkey.ID,
+		&passkey.UserID,
+		&passkey.CredentialID,
+		&passkey.PublicKey,
+		&signCount,
+		&passkey.Name,
+		&lastUsedAt,
+		&passkey.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	passkey.SignCount = uint32(signCount)
+	if lastUsedAt.Valid {
+		passkey.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return &passkey, nil
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch = errors.New("password does not match")
+	errUnknownHash      = errors.New("unknown password hash format")
+)
+
+// argon2Params are the argon2id parameters new hashes are made with. They
+// follow the second recommended option of RFC 9106. Hashes made with other
+// parameters still verify and are upgraded on the next successful login.
+var argon2Params = argonParams{
+	memory:  64 * 1024, // KiB
+	time:    3,
+	threads: 4,
+	saltLen: 16,
+	keyLen:  32,
+}
+
+type argonParams struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	saltLen uint32
+	keyLen  uint32
+}
+
+// Hashes are stored in the PHC string format, e.g.
+//
+//	$argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+//
+// Hashes starting with $2a$ or $2b$ are legacy bcrypt hashes.
+const argon2Prefix = "$argon2id$"
+
+type password struct {
+	text *string
+	hash []byte
+}
+
+func (p *password) Set(text string) error {
+	salt := make([]byte, argon2Params.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	key := argon2.IDKey([]byte(text), salt, argon2Params.time, argon2Params.memory, argon2Params.threads, argon2Params.keyLen)
+
+	p.text = &text
+	p.hash = fmt.Appendf(nil, "%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix,
+		argon2.Version,
+		argon2Params.memory,
+		argon2Params.time,
+		argon2Params.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return nil
+}
+
+func (p *password) Compare(text string) error {
+	if !bytes.HasPrefix(p.hash, []byte(argon2Prefix)) {
+		if err := bcrypt.CompareHashAndPassword(p.hash, []byte(text)); err != nil {
+			return ErrPasswordMismatch
+		}
+		return nil
+	}
+
+	params, salt, key, err := decodeArgon2Hash(p.hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(text), salt, params.time, params.memory, params.threads, params.keyLen)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+
+	return nil
+}
+
+// NeedsRehash reports whether the hash was made with bcrypt or with argon2id
+// parameters other than the current ones.
+func (p *password) NeedsRehash() bool {
+	if !bytes.HasPrefix(p.hash, []byte(argon2Prefix)) {
+		return true
+	}
+
+	params, _, _, err := decodeArgon2Hash(p.hash)
+	return err != nil || params != argon2Params
+}
+
+func decodeArgon2Hash(hash []byte) (argonParams, []byte, []byte, error) {
+	var params argonParams
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := bytes.Split(hash, []byte("$"))
+	if len(parts) != 6 {
+		return params, nil, nil, errUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(string(parts[2]), "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errUnknownHash
+	}
+
+	if _, err := fmt.Sscanf(string(parts[3]), "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, errUnknownHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(string(parts[4]))
+	if err != nil {
+		return params, nil, nil, errUnknownHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(string(parts[5]))
+	if err != nil {
+		return params, nil, nil, errUnknownHash
+	}
+
+	params.saltLen = uint32(len(salt))
+	params.keyLen = uint32(len(key))
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPassword(t *testing.T) {
+	var p password
+	if err := p.Set("correct horse battery staple"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(p.hash, []byte("$argon2id$v=19$m=65536,t=3,p=4$")) {
+		t.Fatalf("unexpected hash %s", p.hash)
+	}
+
+	if err := p.Compare("correct horse battery staple"); err != nil {
+		t.Errorf("Compare() with the password = %v", err)
+	}
+
+	if err := p.Compare("Correct horse battery staple"); err != ErrPasswordMismatch {
+		t.Errorf("Compare() with another password = %v, want %v", err, ErrPasswordMismatch)
+	}
+
+	if p.NeedsRehash() {
+		t.Error("a fresh hash needs a rehash")
+	}
+
+	var other password
+	if err := other.Set("correct horse battery staple"); err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(p.hash, other.hash) {
+		t.Error("two hashes of the same password are equal, the salt is not random")
+	}
+}
+
+func TestPasswordHashFormats(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		hash    string
+		compare error
+		rehash  bool
+	}{
+		{"bcrypt", string(legacy), nil, true},
+		// well-formed, but of another password and with older parameters
+		{"old argon2id parameters", "$argon2id$v=19$m=16384,t=1,p=4$c29tZXNhbHRzb21lc2FsdA$X6DZn0fr5btWNeWy4CLw9WjtQhiVX1lmDCuvyZsQN/M", ErrPasswordMismatch, true},
+		{"other version", "$argon2id$v=16$m=65536,t=3,p=4$c29tZXNhbHRzb21lc2FsdA$AAAA", errUnknownHash, true},
+		{"missing key", "$argon2id$v=19$m=65536,t=3,p=4$c29tZXNhbHRzb21lc2FsdA", errUnknownHash, true},
+		{"bad salt", "$argon2id$v=19$m=65536,t=3,p=4$!!!$AAAA", errUnknownHash, true},
+		{"bad parameters", "$argon2id$v=19$m=lots$c29tZXNhbHRzb21lc2FsdA$AAAA", errUnknownHash, true},
+		{"garbage", "not a hash", ErrPasswordMismatch, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := password{hash: []byte(tt.hash)}
+
+			if err := p.Compare("hunter2"); err != tt.compare {
+				t.Errorf("Compare() = %v, want %v", err, tt.compare)
+			}
+
+			if got := p.NeedsRehash(); got != tt.rehash {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.rehash)
+			}
+		})
+	}
+}
+
+func TestPasswordOldParameters(t *testing.T) {
+	old := argon2Params
+	argon2Params.memory = 16 * 1024
+	argon2Params.time = 1
+
+	var p password
+	err := p.Set("hunter2")
+
+	argon2Params = old
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// hashes made with other parameters still verify, and get upgraded
+	if err := p.Compare("hunter2"); err != nil {
+		t.Errorf("Compare() = %v", err)
+	}
+
+	if !p.NeedsRehash() {
+		t.Error("a hash with old parameters doesn't need a rehash")
+	}
+}
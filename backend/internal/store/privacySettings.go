@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Audiences a privacy setting can be opened up to, from widest to narrowest.
+// Followers are the users the account owner follows, following someone lets
+// them send you cards.
+const (
+	AudienceEveryone  = "everyone"
+	AudienceFollowers = "followers"
+	AudienceFriends   = "friends"
+	AudienceNobody    = "nobody"
+)
+
+// PrivacySettings decide what other users can do with an account. Users that
+// never changed them get the defaults.
+type PrivacySettings struct {
+	UserID            int64      `json:"-"`
+	Private           bool       `json:"private"`            // only friends can see the profile
+	CardSenders       string     `json:"card_senders"`       // audience that may send cards
+	FriendsVisibility string     `json:"friends_visibility"` // audience that may see the friends list
+	UpdatedAt         *time.Time `json:"updated_at"`         // nil until first changed
+}
+
+type PrivacySettingsStore struct {
+	db *sql.DB
+}
+
+func (s *PrivacySettingsStore) GetByUserID(ctx context.Context, userID int64) (*PrivacySettings, error) {
+	query := `
+		SELECT users.id, COALESCE(p.private, FALSE), COALESCE(p.card_senders, $2),
+			COALESCE(p.friends_visibility, $3), p.updated_at
+		FROM users
+		LEFT JOIN privacy_settings p ON (p.user_id = users.id)
+		WHERE users.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var settings PrivacySettings
+	err := s.db.QueryRowContext(ctx, query, userID, AudienceFollowers, AudienceEveryone).Scan(
+		&settings.UserID,
+		&settings.Private,
+		&settings.CardSenders,
+		&settings.FriendsVisibility,
+		&settings.UpdatedAt,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &settings, nil
+}
+
+// Update saves the settings, creating them on the first change
+func (s *PrivacySettingsStore) Update(ctx context.Context, settings *PrivacySettings) error {
+	query := `
+		INSERT INTO privacy_settings (user_id, private, card_senders, friends_visibility)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET private = EXCLUDED.private, card_senders = EXCLUDED.card_senders,
+			friends_visibility = EXCLUDED.friends_visibility, updated_at = NOW()
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		settings.UserID,
+		settings.Private,
+		settings.CardSenders,
+		settings.FriendsVisibility,
+	).Scan(&settings.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
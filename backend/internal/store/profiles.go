@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Who can see a user's birthday
+const (
+	BirthdayPublic  = "public"
+	BirthdayFriends = "friends"
+	BirthdayPrivate = "private"
+)
+
+// Profile is what a user tells others about themselves. Users that never
+// edited their profile get the defaults.
+type Profile struct {
+	UserID             int64      `json:"user_id"`
+	DisplayName        string     `json:"display_name"`
+	Bio                string     `json:"bio"`
+	Pronouns           string     `json:"pronouns"`
+	Birthday           *time.Time `json:"birthday"`
+	BirthdayVisibility string     `json:"birthday_visibility"`
+	Timezone           string     `json:"timezone"`          // IANA time zone name
+	AvatarUpdatedAt    *time.Time `json:"avatar_updated_at"` // nil without an avatar
+	UpdatedAt          *time.Time `json:"updated_at"`        // nil until the profile is first edited
+}
+
+type Avatar struct {
+	UserID      int64     `json:"user_id"`
+	ContentType string    `json:"content_type"`
+	Data        []byte    `json:"-"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type ProfileStore struct {
+	db *sql.DB
+}
+
+func (s *ProfileStore) GetByUserID(ctx context.Context, userID int64) (*Profile, error) {
+	query := `
+		SELECT users.id, COALESCE(p.display_name, ''), COALESCE(p.bio, ''), COALESCE(p.pronouns, ''),
+			p.birthday, COALESCE(p.birthday_visibility, $2), COALESCE(p.timezone, 'UTC'), a.updated_at, p.updated_at
+		FROM users
+		LEFT JOIN user_profiles p ON (p.user_id = users.id)
+		LEFT JOIN user_avatars a ON (a.user_id = users.id)
+		WHERE users.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var profile Profile
+	err := s.db.QueryRowContext(ctx, query, userID, BirthdayPrivate).Scan(
+		&profile.UserID,
+		&profile.DisplayName,
+		&profile.Bio,
+		&profile.Pronouns,
+		&profile.Birthday,
+		&profile.BirthdayVisibility,
+		&profile.Timezone,
+		&profile.AvatarUpdatedAt,
+		&profile.UpdatedAt,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &profile, nil
+}
+
+// Update saves the profile, creating it on the first edit
+func (s *ProfileStore) Update(ctx context.Context, profile *Profile) error {
+	query := `
+		INSERT INTO user_profiles (user_id, display_name, bio, pronouns, birthday, birthday_visibility, timezone)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE
+		SET display_name = EXCLUDED.display_name, bio = EXCLUDED.bio, pronouns = EXCLUDED.pronouns,
+			birthday = EXCLUDED.birthday, birthday_visibility = EXCLUDED.birthday_visibility,
+			timezone = EXCLUDED.timezone, updated_at = NOW()
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		profile.UserID,
+		profile.DisplayName,
+		profile.Bio,
+		profile.Pronouns,
+		profile.Birthday,
+		profile.BirthdayVisibility,
+		profile.Timezone,
+	).Scan(&profile.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *ProfileStore) GetAvatar(ctx context.Context, userID int64) (*Avatar, error) {
+	query := `
+		SELECT user_id, content_type, data, updated_at
+		FROM user_avatars
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var avatar Avatar
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&avatar.UserID,
+		&avatar.ContentType,
+		&avatar.Data,
+		&avatar.UpdatedAt,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &avatar, nil
+}
+
+// SetAvatar replaces the user's avatar
+func (s *ProfileStore) SetAvatar(ctx context.Context, avatar *Avatar) error {
+	query := `
+		INSERT INTO user_avatars (user_id, content_type, data)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET content_type = EXCLUDED.content_type, data = EXCLUDED.data, updated_at = NOW()
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		avatar.UserID,
+		avatar.ContentType,
+		avatar.Data,
+	).Scan(&avatar.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *ProfileStore) DeleteAvatar(ctx context.Context, userID int64) error {
+	query := `
+		DELETE FROM user_avatars
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -18,28 +18,139 @@ var (
 type Storage struct {
 	Users interface {
 		Create(context.Context, *sql.Tx, *User) error
-		CreateAndInvite(context.Context, *User, string, time.Duration) error
+		CreateAndInvite(context.Context, *User, string, string, time.Duration) error
+		UndoRegistration(context.Context, int64, string) error
+		CreateWithIdentity(context.Context, *User, *Identity) error
+		Activate(context.Context, string) (int64, error)
+		CreatePasswordReset(context.Context, int64, string, time.Duration) error
+		GetByPasswordReset(context.Context, string) (*User, error)
+		ResetPassword(context.Context, string, *User) error
+		UpdatePassword(context.Context, *User) error
+		RehashPassword(context.Context, *User) error
+		CreateEmailChange(context.Context, int64, string, string, time.Duration) error
+		ConfirmEmailChange(context.Context, string) (int64, error)
+		CreateLoginLink(context.Context, int64, string, time.Duration) error
+		ConsumeLoginLink(context.Context, string) (int64, error)
 		GetByID(context.Context, int64) (*User, error)
+		GetByEmail(context.Context, string) (*User, error)
+		GetByUsername(context.Context, string) (*User, error)
+		GetByPreviousUsername(context.Context, string) (*User, error)
+		GetByInviter(context.Context, int64) ([]*User, error)
 		Update(context.Context, *User) error
+		UpdateRole(context.Context, int64, int64) error
+		Suspend(context.Context, int64) error
+		Unsuspend(context.Context, int64) error
 		Delete(context.Context, int64) error
+		ScheduleDeletion(context.Context, int64, string, time.Time) error
+		CancelDeletion(context.Context, string) (int64, error)
+		Purge(context.Context) ([]int64, error)
 	}
 	UserTokens interface {
 		Create(context.Context, *sql.Tx, *UserToken) error
+		Issue(context.Context, *UserToken) error
+		GetByID(context.Context, int64) (*UserToken, error)
 		GetByToken(context.Context, string) (*UserToken, error)
 		GetByUserID(context.Context, int64) ([]*UserToken, error)
+		Rotate(context.Context, *UserToken, string) error
+		Touch(context.Context, int64, int64) error
 		Delete(context.Context, int64) error
 		DeleteByUserID(context.Context, int64) error
+		DeleteOthersByUserID(context.Context, int64, int64) error
+	}
+	Identities interface {
+		Create(context.Context, *sql.Tx, *Identity) error
+		Link(context.Context, *Identity) error
+		GetBySubject(context.Context, string, string) (*Identity, error)
+		GetByUserID(context.Context, int64) ([]*Identity, error)
+		Delete(context.Context, int64, int64) error
+		CreateState(context.Context, *OIDCState) error
+		ConsumeState(context.Context, string, string) (*OIDCState, error)
+	}
+	Passkeys interface {
+		Create(context.Context, *sql.Tx, *Passkey) error
+		Register(context.Context, *Passkey) error
+		GetByCredentialID(context.Context, []byte) (*Passkey, error)
+		GetByUserID(context.Context, int64) ([]*Passkey, error)
+		UpdateSignCount(context.Context, int64, uint32) error
+		Delete(context.Context, int64, int64) error
+		CreateChallenge(context.Context, *WebAuthnChallenge) error
+		ConsumeChallenge(context.Context, string, string) (*WebAuthnChallenge, error)
+	}
+	TwoFactor interface {
+		SetPendingSecret(context.Context, int64, string) error
+		Enable(context.Context, int64, []string) error
+		Disable(context.Context, int64) error
+		UseStep(context.Context, int64, int64) error
+		UseRecoveryCode(context.Context, int64, string) error
+		CreateChallenge(context.Context, *MFAChallenge) error
+		GetChallenge(context.Context, string) (*MFAChallenge, error)
+		ConsumeChallenge(context.Context, string) (*MFAChallenge, error)
+	}
+	Invites interface {
+		Create(context.Context, *InviteCode) error
+		GetByCreator(context.Context, int64) ([]*InviteCode, error)
+		CountActiveByCreator(context.Context, int64) (int, error)
+		Delete(context.Context, int64, int64) error
+	}
+	LoginAttempts interface {
+		Record(context.Context, int64, string, string) error
+		FailuresByEmail(context.Context, string, time.Time) (*FailedLogins, error)
+		FailuresByIP(context.Context, string, time.Time) (*FailedLogins, error)
+		Clear(context.Context, int64) error
+		Lock(context.Context, int64, time.Time, string, time.Duration) error
+		Unlock(context.Context, string) (int64, error)
+	}
+	PrivacySettings interface {
+		GetByUserID(context.Context, int64) (*PrivacySettings, error)
+		Update(context.Context, *PrivacySettings) error
+	}
+	Profiles interface {
+		GetByUserID(context.Context, int64) (*Profile, error)
+		Update(context.Context, *Profile) error
+		GetAvatar(context.Context, int64) (*Avatar, error)
+		SetAvatar(context.Context, *Avatar) error
+		DeleteAvatar(context.Context, int64) error
+	}
+	DataExports interface {
+		Create(context.Context, *DataExport) error
+		GetByUserID(context.Context, int64) ([]*DataExport, error)
+		GetByToken(context.Context, string) (*DataExport, error)
+		Complete(context.Context, *DataExport, string) error
+		Fail(context.Context, int64) error
+		FailStale(context.Context, time.Time) (int64, error)
+		DeleteExpired(context.Context) (int64, error)
+	}
+	SecurityEvents interface {
+		Create(context.Context, *SecurityEvent) error
+		Query(context.Context, SecurityEventFilter) ([]*SecurityEvent, error)
+	}
+	Blocks interface {
+		Block(context.Context, int64, int64) error
+		Unblock(context.Context, int64, int64) error
+		GetByUserID(context.Context, int64, int, int) ([]*User, error)
+		IsBlocked(context.Context, int64, int64) (bool, error)
+	}
+	Mutes interface {
+		Mute(context.Context, int64, int64) error
+		Unmute(context.Context, int64, int64) error
+		GetByUserID(context.Context, int64, int, int) ([]*User, error)
+	}
+	Roles interface {
+		GetByName(context.Context, string) (*Role, error)
 	}
 	Templates interface {
 		GetByID(context.Context, int64) (*Template, error)
 		Create(context.Context, *sql.Tx, *Template) error
+		Publish(context.Context, *Template) error
 		Update(context.Context, *Template) error
 		List(context.Context, int, int) ([]*Template, error)
 	}
 	Cards interface {
 		GetByID(context.Context, int64) (*Card, error)
 		Create(context.Context, *sql.Tx, *Card) error
+		Send(context.Context, *Card, int64) (bool, error)
 		GetByUserID(context.Context, int64, int, int) ([]*Card, error)
+		GetReceivedByUserID(context.Context, int64, int, int) ([]*Card, error)
 		Delete(context.Context, int64) error
 	}
 	Friends interface {
@@ -70,10 +181,12 @@ type Storage struct {
 	Badges interface {
 		GetByID(context.Context, int64) (*Badge, error)
 		Create(context.Context, *sql.Tx, *Badge) error
+		Add(context.Context, *Badge) error
 		ListAll(context.Context) ([]*Badge, error)
 	}
 	UserBadges interface {
 		Create(context.Context, *sql.Tx, *UserBadge) error
+		Award(context.Context, *UserBadge) error
 		GetByID(context.Context, int64, int64) (*UserBadge, error)
 		GetByUserID(context.Context, int64) ([]*Badge, error)
 		Delete(context.Context, int64, int64) error
@@ -82,15 +195,27 @@ type Storage struct {
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Users:         &UserStore{db},
-		UserTokens:    &UserTokenStore{db},
-		Templates:     &TemplateStore{db},
-		Cards:         &CardStore{db},
-		Friends:       &FriendStore{db},
-		Followers:     &FollowerStore{db},
-		Notifications: &NotificationStore{db},
-		Badges:        &BadgeStore{db},
-		UserBadges:    &UserBadgeStore{db},
+		Users:           &UserStore{db},
+		UserTokens:      &UserTokenStore{db},
+		TwoFactor:       &TwoFactorStore{db},
+		Identities:      &IdentityStore{db},
+		Passkeys:        &PasskeyStore{db},
+		Invites:         &InviteStore{db},
+		LoginAttempts:   &LoginAttemptStore{db},
+		SecurityEvents:  &SecurityEventStore{db},
+		DataExports:     &DataExportStore{db},
+		Profiles:        &ProfileStore{db},
+		PrivacySettings: &PrivacySettingsStore{db},
+		Blocks:          &BlockStore{db},
+		Mutes:           &MuteStore{db},
+		Roles:           &RoleStore{db},
+		Templates:       &TemplateStore{db},
+		Cards:           &CardStore{db},
+		Friends:         &FriendStore{db},
+		Followers:       &FollowerStore{db},
+		Notifications:   &NotificationStore{db},
+		Badges:          &BadgeStore{db},
+		UserBadges:      &UserBadgeStore{db},
 	}
 }
 
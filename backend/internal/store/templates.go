@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
@@ -30,11 +31,12 @@ func (s *TemplateStore) GetByID(ctx context.Context, id int64) (*Template, error
 	defer cancel()
 
 	var template Template
+	var data []byte
 	err := s.db.QueryRowContext(ctx, query, id).Scan(
 		&template.ID,
 		&template.Title,
 		&template.Description,
-		&template.Data,
+		&data,
 		&template.CreatedAt,
 		&template.UpdatedAt,
 	)
@@ -48,6 +50,8 @@ func (s *TemplateStore) GetByID(ctx context.Context, id int64) (*Template, error
 		}
 	}
 
+	template.Data = json.RawMessage(data)
+
 	return &template, nil
 }
 
@@ -58,15 +62,21 @@ func (s *TemplateStore) Create(ctx context.Context, tx *sql.Tx, template *Templa
 		RETURNING id, created_at, updated_at
 	`
 
+	// data is stored as JSONB, so it has to be sent as JSON text
+	data, err := json.Marshal(template.Data)
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := tx.QueryRowContext(
+	err = tx.QueryRowContext(
 		ctx,
 		query,
 		template.Title,
 		template.Description,
-		template.Data,
+		string(data),
 	).Scan(
 		&template.ID,
 		&template.CreatedAt,
@@ -80,6 +90,13 @@ func (s *TemplateStore) Create(ctx context.Context, tx *sql.Tx, template *Templa
 	return nil
 }
 
+// Publish creates a template in its own transaction.
+func (s *TemplateStore) Publish(ctx context.Context, template *Template) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.Create(ctx, tx, template)
+	})
+}
+
 func (s *TemplateStore) Update(ctx context.Context, template *Template) error {
 	query := `
 		UPDATE templates
@@ -88,15 +105,20 @@ func (s *TemplateStore) Update(ctx context.Context, template *Template) error {
 		RETURNING updated_at
 	`
 
+	data, err := json.Marshal(template.Data)
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(
+	err = s.db.QueryRowContext(
 		ctx,
 		query,
 		template.Title,
 		template.Description,
-		template.Data,
+		string(data),
 		template.ID,
 		template.UpdatedAt,
 	).Scan(&template.UpdatedAt)
@@ -134,17 +156,19 @@ func (s *TemplateStore) List(ctx context.Context, limit, offset int) ([]*Templat
 
 	for rows.Next() {
 		var template Template
+		var data []byte
 		err := rows.Scan(
 			&template.ID,
 			&template.Title,
 			&template.Description,
-			&template.Data,
+			&data,
 			&template.CreatedAt,
 			&template.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
 		}
+		template.Data = json.RawMessage(data)
 		templates = append(templates, &template)
 	}
 
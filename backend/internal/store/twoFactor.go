@@ -0,0 +1,298 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// MFAChallenge is a login waiting for its second factor. Each challenge is
+// good for a single code; a wrong one gets replaced by a challenge with one
+// more attempt on it.
+type MFAChallenge struct {
+	Token     string // sha256 hash of the mfa token sent to the client
+	UserID    int64
+	Attempts  int // wrong codes entered before this challenge was issued
+	ExpiresAt time.Time
+}
+
+// TwoFactorStore manages TOTP secrets and recovery codes. Recovery codes are
+// stored as sha256 hashes, like every other token.
+type TwoFactorStore struct {
+	db *sql.DB
+}
+
+// SetPendingSecret stores a TOTP secret that still has to be confirmed. It
+// returns ErrNotFound if 2FA is already enabled for the user.
+func (s *TwoFactorStore) SetPendingSecret(ctx context.Context, userID int64, secret string) error {
+	query := `
+		UPDATE users
+		SET totp_secret = $1, totp_last_step = 0, updated_at = NOW()
+		WHERE id = $2 AND totp_enabled = FALSE
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, secret, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Enable turns on 2FA for the user and replaces their recovery codes.
+func (s *TwoFactorStore) Enable(ctx context.Context, userID int64, recoveryCodes []string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE users
+			SET totp_enabled = TRUE, updated_at = NOW()
+			WHERE id = $1 AND totp_secret <> ''
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		result, err := tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		if err := s.deleteRecoveryCodes(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		for _, code := range recoveryCodes {
+			if err := s.createRecoveryCode(ctx, tx, userID, code); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Disable turns off 2FA, forgetting the secret and recovery codes.
+func (s *TwoFactorStore) Disable(ctx context.Context, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE users
+			SET totp_secret = '', totp_enabled = FALSE, totp_last_step = 0, updated_at = NOW()
+			WHERE id = $1
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+
+		return s.deleteRecoveryCodes(ctx, tx, userID)
+	})
+}
+
+// UseStep records the TOTP time step a code was accepted for. Returns
+// ErrNotFound if that step (or a later one) was already used, which stops a
+// code from being replayed within its validity window.
+func (s *TwoFactorStore) UseStep(ctx context.Context, userID, step int64) error {
+	query := `
+		UPDATE users
+		SET totp_last_step = $1
+		WHERE id = $2 AND totp_last_step < $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UseRecoveryCode consumes an unused recovery code. Returns ErrNotFound if the
+// code doesn't exist or was already used.
+func (s *TwoFactorStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	query := `
+		UPDATE user_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code = $2 AND used_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID, code)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CreateChallenge stores a pending second factor check, dropping the user's
+// expired ones
+func (s *TwoFactorStore) CreateChallenge(ctx context.Context, challenge *MFAChallenge) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			DELETE FROM mfa_challenges
+			WHERE user_id = $1 AND expires_at <= $2
+		`
+
+		if _, err := tx.ExecContext(ctx, query, challenge.UserID, time.Now()); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO mfa_challenges (token, user_id, attempts, expires_at)
+			VALUES ($1, $2, $3, $4)
+		`
+
+		_, err := tx.ExecContext(ctx, query, challenge.Token, challenge.UserID, challenge.Attempts, challenge.ExpiresAt)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// GetChallenge returns an unexpired challenge without using it up.
+func (s *TwoFactorStore) GetChallenge(ctx context.Context, token string) (*MFAChallenge, error) {
+	query := `
+		SELECT token, user_id, attempts, expires_at
+		FROM mfa_challenges
+		WHERE token = $1 AND expires_at > $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var challenge MFAChallenge
+	err := s.db.QueryRowContext(ctx, query, token, time.Now()).Scan(
+		&challenge.Token,
+		&challenge.UserID,
+		&challenge.Attempts,
+		&challenge.ExpiresAt,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &challenge, nil
+}
+
+// ConsumeChallenge deletes and returns an unexpired challenge, so an mfa
+// token can only be checked once
+func (s *TwoFactorStore) ConsumeChallenge(ctx context.Context, token string) (*MFAChallenge, error) {
+	query := `
+		DELETE FROM mfa_challenges
+		WHERE token = $1 AND expires_at > $2
+		RETURNING token, user_id, attempts, expires_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var challenge MFAChallenge
+	err := s.db.QueryRowContext(ctx, query, token, time.Now()).Scan(
+		&challenge.Token,
+		&challenge.UserID,
+		&challenge.Attempts,
+		&challenge.ExpiresAt,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &challenge, nil
+}
+
+func (s *TwoFactorStore) createRecoveryCode(ctx context.Context, tx *sql.Tx, userID int64, code string) error {
+	query := `
+		INSERT INTO user_recovery_codes (user_id, code)
+		VALUES ($1, $2)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID, code)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStore) deleteRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `
+		DELETE FROM user_recovery_codes
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -3,9 +3,12 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 )
 
+var ErrDuplicateBadge = errors.New("the user already has this badge")
+
 type UserBadge struct {
 	UserId    int64     `json:"user_id"`
 	BadgeId   int64     `json:"badge_id"`
@@ -21,7 +24,7 @@ func (s *UserBadgeStore) Create(ctx context.Context, tx *sql.Tx, userBadge *User
 	query := `
 		INSERT INTO user_badges (user_id, badge_id)
 		VALUES ($1, $2)
-		RETURNING created_at
+		RETURNING acquired_at
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -35,16 +38,28 @@ func (s *UserBadgeStore) Create(ctx context.Context, tx *sql.Tx, userBadge *User
 	).Scan(&userBadge.CreatedAt)
 
 	if err != nil {
-		return err
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "user_badges_pkey"`:
+			return ErrDuplicateBadge
+		default:
+			return err
+		}
 	}
 
 	return nil
 }
 
+// Award gives a badge to a user in its own transaction.
+func (s *UserBadgeStore) Award(ctx context.Context, userBadge *UserBadge) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.Create(ctx, tx, userBadge)
+	})
+}
+
 // GetByID checks if a user has a specific badge
 func (s *UserBadgeStore) GetByID(ctx context.Context, userID, badgeID int64) (*UserBadge, error) {
 	query := `
-		SELECT user_id, badge_id, created_at
+		SELECT user_id, badge_id, acquired_at
 		FROM user_badges
 		WHERE user_id = $1 AND badge_id = $2
 	`
@@ -74,11 +89,11 @@ func (s *UserBadgeStore) GetByID(ctx context.Context, userID, badgeID int64) (*U
 // GetByUserID retrieves all badges for a user
 func (s *UserBadgeStore) GetByUserID(ctx context.Context, userId int64) ([]*Badge, error) {
 	query := `
-		SELECT b.id, b.title, b.description, b.icon
+		SELECT b.id, b.name, b.description, b.image_url
 		FROM badges b
 		INNER JOIN user_badges ub ON ub.badge_id = b.id
 		WHERE ub.user_id = $1
-		ORDER BY ub.created_at DESC
+		ORDER BY ub.acquired_at DESC
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
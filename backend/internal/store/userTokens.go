@@ -3,13 +3,20 @@ package store
 import (
 	"context"
 	"database/sql"
+	"time"
 )
 
-// UserToken represents a user authentication token in the system
+// UserToken represents a user session. Token is the sha256 hash of the opaque
+// token handed out to the client, which is never stored in plain text.
 type UserToken struct {
-	ID     int64  `json:"id"`
-	Token  string `json:"token"`
-	UserID int64  `json:"user_id"`
+	ID         int64     `json:"id"`
+	Token      string    `json:"-"`
+	UserID     int64     `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 // UserTokenStore provides access to user token storage
@@ -20,9 +27,9 @@ type UserTokenStore struct {
 // Create adds a new user token to the database within a transaction
 func (s *UserTokenStore) Create(ctx context.Context, tx *sql.Tx, token *UserToken) error {
 	query := `
-		INSERT INTO user_tokens (token, user_id)
-		VALUES ($1, $2)
-		RETURNING id
+		INSERT INTO user_tokens (token, user_id, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, last_used_at, created_at
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -33,7 +40,14 @@ func (s *UserTokenStore) Create(ctx context.Context, tx *sql.Tx, token *UserToke
 		query,
 		token.Token,
 		token.UserID,
-	).Scan(&token.ID)
+		token.UserAgent,
+		token.IP,
+		token.ExpiresAt,
+	).Scan(
+		&token.ID,
+		&token.LastUsedAt,
+		&token.CreatedAt,
+	)
 
 	if err != nil {
 		return err
@@ -42,22 +56,69 @@ func (s *UserTokenStore) Create(ctx context.Context, tx *sql.Tx, token *UserToke
 	return nil
 }
 
-// GetByToken retrieves a user token by its token string
+// Issue creates a new user token in its own transaction
+func (s *UserTokenStore) Issue(ctx context.Context, token *UserToken) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.Create(ctx, tx, token)
+	})
+}
+
+// GetByID retrieves an unexpired user token by its ID
+func (s *UserTokenStore) GetByID(ctx context.Context, id int64) (*UserToken, error) {
+	query := `
+		SELECT id, token, user_id, user_agent, ip, last_used_at, expires_at, created_at
+		FROM user_tokens
+		WHERE id = $1 AND expires_at > $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var userToken UserToken
+	err := s.db.QueryRowContext(ctx, query, id, time.Now()).Scan(
+		&userToken.ID,
+		&userToken.Token,
+		&userToken.UserID,
+		&userToken.UserAgent,
+		&userToken.IP,
+		&userToken.LastUsedAt,
+		&userToken.ExpiresAt,
+		&userToken.CreatedAt,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &userToken, nil
+}
+
+// GetByToken retrieves an unexpired user token by its token string
 func (s *UserTokenStore) GetByToken(ctx context.Context, token string) (*UserToken, error) {
 	query := `
-		SELECT id, token, user_id
+		SELECT id, token, user_id, user_agent, ip, last_used_at, expires_at, created_at
 		FROM user_tokens
-		WHERE token = $1
+		WHERE token = $1 AND expires_at > $2
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	var userToken UserToken
-	err := s.db.QueryRowContext(ctx, query, token).Scan(
+	err := s.db.QueryRowContext(ctx, query, token, time.Now()).Scan(
 		&userToken.ID,
 		&userToken.Token,
 		&userToken.UserID,
+		&userToken.UserAgent,
+		&userToken.IP,
+		&userToken.LastUsedAt,
+		&userToken.ExpiresAt,
+		&userToken.CreatedAt,
 	)
 
 	if err != nil {
@@ -72,18 +133,19 @@ func (s *UserTokenStore) GetByToken(ctx context.Context, token string) (*UserTok
 	return &userToken, nil
 }
 
-// GetByUserID retrieves a user's tokens by user ID
+// GetByUserID retrieves a user's unexpired tokens, most recently used first
 func (s *UserTokenStore) GetByUserID(ctx context.Context, userID int64) ([]*UserToken, error) {
 	query := `
-		SELECT id, token, user_id
+		SELECT id, token, user_id, user_agent, ip, last_used_at, expires_at, created_at
 		FROM user_tokens
-		WHERE user_id = $1
+		WHERE user_id = $1 AND expires_at > $2
+		ORDER BY last_used_at DESC
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, userID)
+	rows, err := s.db.QueryContext(ctx, query, userID, time.Now())
 	if err != nil {
 		return nil, err
 	}
@@ -97,6 +159,11 @@ func (s *UserTokenStore) GetByUserID(ctx context.Context, userID int64) ([]*User
 			&token.ID,
 			&token.Token,
 			&token.UserID,
+			&token.UserAgent,
+			&token.IP,
+			&token.LastUsedAt,
+			&token.ExpiresAt,
+			&token.CreatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -111,6 +178,75 @@ func (s *UserTokenStore) GetByUserID(ctx context.Context, userID int64) ([]*User
 	return tokens, nil
 }
 
+// Rotate replaces the token of an existing session in place, keeping its ID.
+// token.Token must hold the current hash; it is only swapped if that hash
+// still matches, so a token can only ever be rotated once. Returns
+// ErrNotFound otherwise.
+func (s *UserTokenStore) Rotate(ctx context.Context, token *UserToken, newToken string) error {
+	query := `
+		UPDATE user_tokens
+		SET token = $1, user_agent = $2, ip = $3, expires_at = $4, last_used_at = NOW()
+		WHERE id = $5 AND token = $6
+		RETURNING last_used_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		newToken,
+		token.UserAgent,
+		token.IP,
+		token.ExpiresAt,
+		token.ID,
+		token.Token,
+	).Scan(&token.LastUsedAt)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	token.Token = newToken
+
+	return nil
+}
+
+// Touch records that a session was used. Returns ErrNotFound if the session
+// was revoked, expired or does not belong to the user.
+func (s *UserTokenStore) Touch(ctx context.Context, id, userID int64) error {
+	query := `
+		UPDATE user_tokens
+		SET last_used_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND expires_at > $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, id, userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
 // Delete removes a user token by its ID
 func (s *UserTokenStore) Delete(ctx context.Context, id int64) error {
 	query := `
@@ -140,6 +276,14 @@ func (s *UserTokenStore) Delete(ctx context.Context, id int64) error {
 
 // DeleteByUserID removes all tokens for a specific user
 func (s *UserTokenStore) DeleteByUserID(ctx context.Context, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return deleteUserTokens(ctx, tx, userID)
+	})
+}
+
+// deleteUserTokens ends every session of the user as part of a larger
+// transaction, e.g. a password reset
+func deleteUserTokens(ctx context.Context, tx *sql.Tx, userID int64) error {
 	query := `
 		DELETE FROM user_tokens
 		WHERE user_id = $1
@@ -148,7 +292,25 @@ func (s *UserTokenStore) DeleteByUserID(ctx context.Context, userID int64) error
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, userID)
+	_, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteOthersByUserID removes all tokens for a user except the given one
+func (s *UserTokenStore) DeleteOthersByUserID(ctx context.Context, userID, keepID int64) error {
+	query := `
+		DELETE FROM user_tokens
+		WHERE user_id = $1 AND id <> $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, keepID)
 	if err != nil {
 		return err
 	}
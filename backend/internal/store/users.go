@@ -4,44 +4,40 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	ErrDuplicateEmail    = errors.New("a user with that email already exists")
 	ErrDuplicateUsername = errors.New("a user with that username already exists")
+
+	// UsernameHoldDuration is how long a username stays with its previous
+	// owner after a rename, so links keep working and nobody can squat it.
+	UsernameHoldDuration = time.Hour * 24 * 30
 )
 
+// User is the account as stored. Fields that only the owner may see are
+// excluded from JSON; the API serializes users through explicit views.
 type User struct {
-	ID           int64     `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	Password     password  `json:"-"`
-	Verified     bool      `json:"verified"`      // email is verified
-	FriendHash   password  `json:"friend_hash"`   // hash of user's friends
-	FollowerHash password  `json:"follower_hash"` // hash of user's followers
-	UpdatedAt    time.Time `json:"updated_at"`    // last time user was updated
-	CreatedAt    time.Time `json:"created_at"`    // user's account creation date
-}
-
-type password struct {
-	text *string
-	hash []byte
-}
-
-func (p *password) Set(text string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(text), bcrypt.DefaultCost)
-	if err != nil {
-		return err
-	}
-
-	p.text = &text
-	p.hash = hash
-
-	return nil
+	ID           int64      `json:"id"`
+	Username     string     `json:"username"`
+	Email        string     `json:"-"`
+	Password     password   `json:"-"`
+	Verified     bool       `json:"-"` // email is verified
+	FriendHash   password   `json:"-"` // hash of user's friends
+	FollowerHash password   `json:"-"` // hash of user's followers
+	TOTPSecret   string     `json:"-"`
+	TOTPEnabled  bool       `json:"-"` // two-factor authentication is on
+	Role         Role       `json:"-"`
+	SuspendedAt  *time.Time `json:"-"`          // set while a moderator has suspended the account
+	LockedUntil  *time.Time `json:"-"`          // set after too many failed logins
+	InvitedBy    *int64     `json:"-"`          // user whose invite code was used to register
+	PurgeAt      *time.Time `json:"-"`          // set while the account is pending deletion
+	UpdatedAt    time.Time  `json:"updated_at"` // last time user was updated
+	CreatedAt    time.Time  `json:"created_at"` // user's account creation date
 }
 
 type UserStore struct {
@@ -49,9 +45,13 @@ type UserStore struct {
 }
 
 func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
+	if err := s.checkUsernameHeld(ctx, tx, user.Username, 0); err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO users (username, password, email)
-		VALUES ($1, $2, $3)
+		INSERT INTO users (username, password, email, invited_by)
+		VALUES ($1, $2, $3, $4)
 		RETURNING id, created_at
 	`
 
@@ -64,6 +64,7 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 		user.Username,
 		user.Password.hash,
 		user.Email,
+		user.InvitedBy,
 	).Scan(
 		&user.ID,
 		&user.CreatedAt,
@@ -85,9 +86,11 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 
 func (s *UserStore) GetByID(ctx context.Context, id int64) (*User, error) {
 	query := `
-		SELECT id, username, email, verified, friend_hash, follower_hash, updated_at, created_at
+		SELECT users.id, username, email, password, verified, friend_hash, follower_hash, totp_secret, totp_enabled,
+			suspended_at, locked_until, invited_by, purge_at, updated_at, created_at, roles.id, roles.name, roles.level, roles.description
 		FROM users
-		WHERE id = $1
+		JOIN roles ON (users.role_id = roles.id)
+		WHERE users.id = $1
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -98,11 +101,116 @@ func (s *UserStore) GetByID(ctx context.Context, id int64) (*User, error) {
 		&user.ID,
 		&user.Username,
 		&user.Email,
+		&user.Password.hash,
+		&user.Verified,
+		&user.FriendHash.hash,
+		&user.FollowerHash.hash,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.SuspendedAt,
+		&user.LockedUntil,
+		&user.InvitedBy,
+		&user.PurgeAt,
+		&user.UpdatedAt,
+		&user.CreatedAt,
+		&user.Role.ID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.Role.Description,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	query := `
+		SELECT users.id, username, email, password, verified, friend_hash, follower_hash, totp_secret, totp_enabled,
+			suspended_at, locked_until, invited_by, purge_at, updated_at, created_at, roles.id, roles.name, roles.level, roles.description
+		FROM users
+		JOIN roles ON (users.role_id = roles.id)
+		WHERE users.email = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var user User
+	err := s.db.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.Verified,
+		&user.FriendHash.hash,
+		&user.FollowerHash.hash,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.SuspendedAt,
+		&user.LockedUntil,
+		&user.InvitedBy,
+		&user.PurgeAt,
+		&user.UpdatedAt,
+		&user.CreatedAt,
+		&user.Role.ID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.Role.Description,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (s *UserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	query := `
+		SELECT users.id, username, email, password, verified, friend_hash, follower_hash, totp_secret, totp_enabled,
+			suspended_at, locked_until, invited_by, purge_at, updated_at, created_at, roles.id, roles.name, roles.level, roles.description
+		FROM users
+		JOIN roles ON (users.role_id = roles.id)
+		WHERE users.username = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var user User
+	err := s.db.QueryRowContext(ctx, query, username).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
 		&user.Verified,
-		&user.FriendHash,
-		&user.FollowerHash,
+		&user.FriendHash.hash,
+		&user.FollowerHash.hash,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.SuspendedAt,
+		&user.LockedUntil,
+		&user.InvitedBy,
+		&user.PurgeAt,
 		&user.UpdatedAt,
 		&user.CreatedAt,
+		&user.Role.ID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.Role.Description,
 	)
 
 	if err != nil {
@@ -117,9 +225,84 @@ func (s *UserStore) GetByID(ctx context.Context, id int64) (*User, error) {
 	return &user, nil
 }
 
-func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error {
+// GetByInviter lists the users that registered with one of the user's
+// invite codes
+func (s *UserStore) GetByInviter(ctx context.Context, userID int64) ([]*User, error) {
+	query := `
+		SELECT id, username, created_at
+		FROM users
+		WHERE invited_by = $1 AND purge_at IS NULL
+		ORDER BY created_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// GetByPreviousUsername finds the user that gave up the username within the
+// last UsernameHoldDuration.
+func (s *UserStore) GetByPreviousUsername(ctx context.Context, username string) (*User, error) {
+	query := `
+		SELECT user_id
+		FROM username_history
+		WHERE username = $1 AND released_at > $2
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var userID int64
+	err := s.db.QueryRowContext(ctx, query, username, time.Now()).Scan(&userID)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return s.GetByID(ctx, userID)
+}
+
+// CreateAndInvite creates the user along with their activation invitation.
+// A non-empty inviteCode is redeemed in the same transaction and recorded as
+// who invited the user.
+func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, inviteCode, token string, invitationExp time.Duration) error {
 	// transaction wrapper
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if inviteCode != "" {
+			invitedBy, err := redeemInviteCode(ctx, tx, inviteCode)
+			if err != nil {
+				return err
+			}
+			user.InvitedBy = &invitedBy
+		}
+
 		// create the user
 		if err := s.Create(ctx, tx, user); err != nil {
 			return err
@@ -134,79 +317,799 @@ func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token strin
 	})
 }
 
-func (s *UserStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token string, exp time.Duration, userID int64) error {
+// UndoRegistration deletes a user created by CreateAndInvite when the rest
+// of the registration failed, and gives the invite code back its use.
+func (s *UserStore) UndoRegistration(ctx context.Context, userID int64, inviteCode string) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM users
+			WHERE id = $1
+		`
+
 		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 		defer cancel()
 
-		query := `
-			INSERT INTO user_invitations (token, user_id, expires_at)
-			VALUES ($1, NOW() + $2, $3)
-		`
+		res, err := tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		if inviteCode == "" {
+			return nil
+		}
 
-		_, err := tx.ExecContext(ctx, query, token, userID, exp)
+		return releaseInviteCode(ctx, tx, inviteCode)
+	})
+}
+
+// CreateWithIdentity creates a user signing up through an OpenID Connect
+// provider and links the identity. The email counts as verified when the
+// provider says so.
+func (s *UserStore) CreateWithIdentity(ctx context.Context, user *User, identity *Identity) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.Create(ctx, tx, user); err != nil {
+			return err
+		}
+
+		if user.Verified {
+			if err := s.verify(ctx, tx, user.ID); err != nil {
+				return err
+			}
+		}
+
+		identity.UserID = user.ID
+		identities := &IdentityStore{s.db}
+
+		return identities.Create(ctx, tx, identity)
+	})
+}
+
+func (s *UserStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token string, exp time.Duration, userID int64) error {
+	query := `
+		INSERT INTO user_invitations (token, user_id, expires_at)
+		VALUES ($1, $2, $3)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, token, userID, time.Now().Add(exp))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Activate verifies the user that owns the (hashed) invitation token,
+// removes their pending invitations and returns their id. Expired tokens are
+// treated as not found.
+func (s *UserStore) Activate(ctx context.Context, token string) (int64, error) {
+	var userID int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// find the user the token belongs to
+		var err error
+		userID, err = s.getUserIDFromInvitation(ctx, tx, token)
 		if err != nil {
 			return err
 		}
 
+		// mark the email as verified
+		if err := s.verify(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		// clean up the invitations
+		if err := s.deleteUserInvitations(ctx, tx, userID); err != nil {
+			return err
+		}
+
 		return nil
 	})
+
+	return userID, err
 }
 
-func (s *UserStore) Delete(ctx context.Context, id int64) error {
+func (s *UserStore) getUserIDFromInvitation(ctx context.Context, tx *sql.Tx, token string) (int64, error) {
 	query := `
-		DELETE FROM users
+		SELECT user_id
+		FROM user_invitations
+		WHERE token = $1 AND expires_at > $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var userID int64
+	err := tx.QueryRowContext(ctx, query, token, time.Now()).Scan(&userID)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+func (s *UserStore) verify(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `
+		UPDATE users
+		SET verified = TRUE, updated_at = NOW()
 		WHERE id = $1
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	res, err := s.db.ExecContext(ctx, query, id)
+	_, err := tx.ExecContext(ctx, query, userID)
 	if err != nil {
 		return err
 	}
 
-	rows, err := res.RowsAffected()
+	return nil
+}
+
+func (s *UserStore) deleteUserInvitations(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `
+		DELETE FROM user_invitations
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
 	if err != nil {
 		return err
 	}
 
-	if rows == 0 {
-		return ErrNotFound
+	return nil
+}
+
+// CreatePasswordReset stores a (hashed) single-use password reset token.
+func (s *UserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	query := `
+		INSERT INTO password_resets (token, user_id, expires_at)
+		VALUES ($1, $2, $3)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, token, userID, time.Now().Add(exp))
+	if err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func (s *UserStore) Update(ctx context.Context, user *User) error {
+// ResetPassword stores user.Password for the owner of the (hashed) reset
+// token, then invalidates every reset token and session of that user.
+// Expired tokens are treated as not found.
+func (s *UserStore) ResetPassword(ctx context.Context, token string, user *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// claim the token, a concurrent reset with it finds nothing
+		userID, err := s.consumePasswordReset(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+		user.ID = userID
+
+		if err := s.updatePassword(ctx, tx, user); err != nil {
+			return err
+		}
+
+		if err := s.deletePasswordResets(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		// log the user out everywhere
+		return deleteUserTokens(ctx, tx, userID)
+	})
+}
+
+// GetByPasswordReset looks up the user a password reset token belongs to
+// without using the token up.
+func (s *UserStore) GetByPasswordReset(ctx context.Context, token string) (*User, error) {
+	query := `
+		SELECT user_id
+		FROM password_resets
+		WHERE token = $1 AND expires_at > $2
+	`
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
+	var userID int64
+	err := s.db.QueryRowContext(ctx, query, token, time.Now()).Scan(&userID)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return s.GetByID(ctx, userID)
+}
+
+func (s *UserStore) consumePasswordReset(ctx context.Context, tx *sql.Tx, token string) (int64, error) {
 	query := `
-		UPDATE users
-		SET username = $1, email = $2, updated_at = NOW()
-		WHERE id = $3 AND updated_at = $4
-    RETURNING updated_at
+		DELETE FROM password_resets
+		WHERE token = $1 AND expires_at > $2
+		RETURNING user_id
 	`
 
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		user.Username,
-		user.Email,
-		user.ID,
-		user.UpdatedAt,
-	).Scan(&user.UpdatedAt)
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
 
+	var userID int64
+	err := tx.QueryRowContext(ctx, query, token, time.Now()).Scan(&userID)
 	if err != nil {
 		switch err {
 		case sql.ErrNoRows:
-			return ErrNotFound
+			return 0, ErrNotFound
 		default:
-			return err
+			return 0, err
 		}
 	}
 
+	return userID, nil
+}
+
+// UpdatePassword stores the hash currently set on user.Password.
+func (s *UserStore) UpdatePassword(ctx context.Context, user *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.updatePassword(ctx, tx, user)
+	})
+}
+
+// RehashPassword stores a new hash of the same password, so unlike
+// UpdatePassword it doesn't count as a change to the account.
+func (s *UserStore) RehashPassword(ctx context.Context, user *User) error {
+	query := `
+		UPDATE users
+		SET password = $1
+		WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, user.Password.hash, user.ID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *UserStore) updatePassword(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `
+		UPDATE users
+		SET password = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(ctx, query, user.Password.hash, user.ID).Scan(&user.UpdatedAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *UserStore) deletePasswordResets(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `
+		DELETE FROM password_resets
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateEmailChange stores a pending email change, keyed by a (hashed)
+// confirmation token. The user's email is left untouched until confirmed.
+func (s *UserStore) CreateEmailChange(ctx context.Context, userID int64, newEmail, token string, exp time.Duration) error {
+	query := `
+		INSERT INTO email_changes (token, user_id, new_email, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, token, userID, newEmail, time.Now().Add(exp))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange swaps in the new email of the pending change identified
+// by the (hashed) token and drops the user's other pending changes. The new
+// address counts as verified since the token was delivered to it.
+func (s *UserStore) ConfirmEmailChange(ctx context.Context, token string) (int64, error) {
+	var userID int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			SELECT user_id, new_email
+			FROM email_changes
+			WHERE token = $1 AND expires_at > $2
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var newEmail string
+		err := tx.QueryRowContext(ctx, query, token, time.Now()).Scan(&userID, &newEmail)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		query = `
+			UPDATE users
+			SET email = $1, verified = TRUE, updated_at = NOW()
+			WHERE id = $2
+		`
+
+		if _, err := tx.ExecContext(ctx, query, newEmail, userID); err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+				return ErrDuplicateEmail
+			default:
+				return err
+			}
+		}
+
+		query = `
+			DELETE FROM email_changes
+			WHERE user_id = $1
+		`
+
+		_, err = tx.ExecContext(ctx, query, userID)
+		return err
+	})
+
+	return userID, err
+}
+
+// CreateLoginLink stores a (hashed) single-use passwordless login token.
+func (s *UserStore) CreateLoginLink(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	query := `
+		INSERT INTO login_links (token, user_id, expires_at)
+		VALUES ($1, $2, $3)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, token, userID, time.Now().Add(exp))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeLoginLink deletes the login link identified by the (hashed) token and
+// returns the id of its user. Expired or already used links are not found.
+func (s *UserStore) ConsumeLoginLink(ctx context.Context, token string) (int64, error) {
+	query := `
+		DELETE FROM login_links
+		WHERE token = $1 AND expires_at > $2
+		RETURNING user_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var userID int64
+	err := s.db.QueryRowContext(ctx, query, token, time.Now()).Scan(&userID)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+// Suspend locks the user out and revokes every session they have open.
+func (s *UserStore) Suspend(ctx context.Context, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.setSuspended(ctx, tx, userID, true); err != nil {
+			return err
+		}
+
+		return deleteUserTokens(ctx, tx, userID)
+	})
+}
+
+func (s *UserStore) Unsuspend(ctx context.Context, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.setSuspended(ctx, tx, userID, false)
+	})
+}
+
+func (s *UserStore) setSuspended(ctx context.Context, tx *sql.Tx, userID int64, suspended bool) error {
+	query := `
+		UPDATE users
+		SET suspended_at = CASE WHEN $1 THEN NOW() END, updated_at = NOW()
+		WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, query, suspended, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *UserStore) UpdateRole(ctx context.Context, userID, roleID int64) error {
+	query := `
+		UPDATE users
+		SET role_id = $1, updated_at = NOW()
+		WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, roleID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *UserStore) Delete(ctx context.Context, id int64) error {
+	query := `
+		DELETE FROM users
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ScheduleDeletion deactivates the account, signs the user out everywhere
+// and stores the token that lets them cancel the deletion until purgeAt.
+func (s *UserStore) ScheduleDeletion(ctx context.Context, userID int64, token string, purgeAt time.Time) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE users
+			SET purge_at = $1, updated_at = NOW()
+			WHERE id = $2 AND purge_at IS NULL
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, purgeAt, userID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		query = `
+			INSERT INTO account_deletions (token, user_id, expires_at)
+			VALUES ($1, $2, $3)
+		`
+
+		if _, err := tx.ExecContext(ctx, query, token, userID, purgeAt); err != nil {
+			return err
+		}
+
+		return deleteUserTokens(ctx, tx, userID)
+	})
+}
+
+// CancelDeletion reactivates the account the token was issued for and
+// returns its id.
+func (s *UserStore) CancelDeletion(ctx context.Context, token string) (int64, error) {
+	var userID int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			DELETE FROM account_deletions
+			WHERE token = $1 AND expires_at > $2
+			RETURNING user_id
+		`
+
+		err := tx.QueryRowContext(ctx, query, token, time.Now()).Scan(&userID)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		query = `
+			UPDATE users
+			SET purge_at = NULL, updated_at = NOW()
+			WHERE id = $1
+		`
+
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	return userID, err
+}
+
+// Purge deletes the accounts whose grace period is over and returns their
+// ids. Their cards are kept without an author, everything else goes with
+// the account.
+func (s *UserStore) Purge(ctx context.Context) ([]int64, error) {
+	query := `
+		DELETE FROM users
+		WHERE purge_at <= $1
+		RETURNING id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (s *UserStore) Update(ctx context.Context, user *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		previous, err := s.getUsername(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		// usernames are case insensitive, so a change of case isn't a rename
+		if !strings.EqualFold(previous, user.Username) {
+			if err := s.rename(ctx, tx, user.ID, previous, user.Username); err != nil {
+				return err
+			}
+		}
+
+		query := `
+			UPDATE users
+			SET username = $1, email = $2, updated_at = NOW()
+			WHERE id = $3 AND updated_at = $4
+			RETURNING updated_at
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			user.Username,
+			user.Email,
+			user.ID,
+			user.UpdatedAt,
+		).Scan(&user.UpdatedAt)
+
+		if err != nil {
+			switch {
+			case err == sql.ErrNoRows:
+				return ErrNotFound
+			case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+				return ErrDuplicateUsername
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// getUsername locks the user's row for the rest of the transaction and
+// returns their current username.
+func (s *UserStore) getUsername(ctx context.Context, tx *sql.Tx, userID int64) (string, error) {
+	query := `
+		SELECT username
+		FROM users
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var username string
+	err := tx.QueryRowContext(ctx, query, userID).Scan(&username)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return "", ErrNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return username, nil
+}
+
+// rename records the previous username in the history so it keeps pointing
+// at the user for UsernameHoldDuration. Taking back one of your own previous
+// usernames removes it from the history.
+func (s *UserStore) rename(ctx context.Context, tx *sql.Tx, userID int64, previous, username string) error {
+	if err := s.checkUsernameHeld(ctx, tx, username, userID); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		DELETE FROM username_history
+		WHERE user_id = $1 AND username = $2
+	`
+
+	if _, err := tx.ExecContext(ctx, query, userID, username); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO username_history (user_id, username, released_at)
+		VALUES ($1, $2, $3)
+	`
+
+	if _, err := tx.ExecContext(ctx, query, userID, previous, time.Now().Add(UsernameHoldDuration)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// checkUsernameHeld fails with ErrDuplicateUsername when another user gave
+// up the username too recently for it to be taken. userID is the user
+// asking for it, or 0 for a new account.
+func (s *UserStore) checkUsernameHeld(ctx context.Context, tx *sql.Tx, username string, userID int64) error {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM username_history
+			WHERE username = $1 AND user_id <> $2 AND released_at > $3
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var held bool
+	if err := tx.QueryRowContext(ctx, query, username, userID, time.Now()).Scan(&held); err != nil {
+		return err
+	}
+
+	if held {
+		return ErrDuplicateUsername
+	}
+
 	return nil
 }
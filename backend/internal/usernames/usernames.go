@@ -0,0 +1,102 @@
+// Package usernames decides which usernames can be registered.
+package usernames
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	MinLength = 3
+	MaxLength = 30
+)
+
+var (
+	ErrLength   = errors.New("must be between 3 and 30 characters long")
+	ErrCharset  = errors.New("may only contain letters, digits and underscores")
+	ErrReserved = errors.New("is reserved")
+)
+
+// reserved names can't be registered because they could be mistaken for the
+// app itself or clash with routes of the frontend.
+var reserved = map[string]bool{
+	"about":         true,
+	"account":       true,
+	"admin":         true,
+	"administrator": true,
+	"api":           true,
+	"app":           true,
+	"grace":         true,
+	"help":          true,
+	"login":         true,
+	"logout":        true,
+	"me":            true,
+	"mod":           true,
+	"moderator":     true,
+	"null":          true,
+	"official":      true,
+	"root":          true,
+	"security":      true,
+	"settings":      true,
+	"signup":        true,
+	"staff":         true,
+	"support":       true,
+	"system":        true,
+	"team":          true,
+	"undefined":     true,
+	"users":         true,
+}
+
+// Normalize applies Unicode NFKC normalization, so look-alike forms such as
+// full-width letters become plain ASCII, and checks the result against the
+// username policy. The returned name keeps its case; uniqueness is case
+// insensitive in the database.
+func Normalize(name string) (string, error) {
+	name = norm.NFKC.String(strings.TrimSpace(name))
+
+	if len(name) < MinLength || len(name) > MaxLength {
+		return "", ErrLength
+	}
+
+	for _, c := range name {
+		if !isAllowed(c) {
+			return "", ErrCharset
+		}
+	}
+
+	if IsReserved(name) {
+		return "", ErrReserved
+	}
+
+	return name, nil
+}
+
+// IsReserved reports whether name is a reserved word, also when it is only
+// dressed up with underscores and digits like "_admin_" or "grace1".
+func IsReserved(name string) bool {
+	bare := strings.TrimRight(strings.ReplaceAll(strings.ToLower(name), "_", ""), "0123456789")
+	return reserved[bare]
+}
+
+// Sanitize turns arbitrary text, like a display name, into a valid username
+// prefix of at most n characters by dropping everything the policy doesn't
+// allow. Accents are decomposed first so "José" keeps its "e". The result may
+// be shorter than MinLength or reserved.
+func Sanitize(text string, n int) string {
+	var b strings.Builder
+	for _, c := range norm.NFKD.String(strings.ToLower(text)) {
+		if b.Len() >= n {
+			break
+		}
+		if isAllowed(c) {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+func isAllowed(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_'
+}
@@ -0,0 +1,88 @@
+package usernames
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+		err  error
+	}{
+		{"plain", "jane_doe", "jane_doe", nil},
+		{"keeps case", "JaneDoe", "JaneDoe", nil},
+		{"trims spaces", "  jane  ", "jane", nil},
+		{"full-width letters", "ｊａｎｅ", "jane", nil},
+		{"shortest", "abc", "abc", nil},
+		{"longest", strings.Repeat("a", MaxLength), strings.Repeat("a", MaxLength), nil},
+		{"too short", "ab", "", ErrLength},
+		{"too long", strings.Repeat("a", MaxLength+1), "", ErrLength},
+		{"empty", "", "", ErrLength},
+		{"space", "jane doe", "", ErrCharset},
+		{"dash", "jane-doe", "", ErrCharset},
+		{"accent", "josé", "", ErrCharset},
+		{"cyrillic look-alike", "jаne", "", ErrCharset},
+		{"emoji", "jane🙂", "", ErrCharset},
+		{"reserved", "admin", "", ErrReserved},
+		{"reserved in another case", "Admin", "", ErrReserved},
+		{"reserved full-width", "ａｄｍｉｎ", "", ErrReserved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.in)
+			if got != tt.want || err != tt.err {
+				t.Errorf("Normalize(%q) = %q, %v, want %q, %v", tt.in, got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestIsReserved(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"admin", true},
+		{"ADMIN", true},
+		{"_admin_", true},
+		{"ad_min", true},
+		{"grace1", true},
+		{"support42", true},
+		{"1grace", false},
+		{"admins", false},
+		{"jane", false},
+		{"gracefully", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsReserved(tt.name); got != tt.want {
+			t.Errorf("IsReserved(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		text string
+		n    int
+		want string
+	}{
+		{"Jane Doe", 30, "janedoe"},
+		{"José Álvarez", 30, "josealvarez"},
+		{"jane.doe+grace", 30, "janedoegrace"},
+		{"snake_case_name", 30, "snake_case_name"},
+		{"Jane Doe", 4, "jane"},
+		{"日本語", 30, ""},
+		{"", 30, ""},
+	}
+
+	for _, tt := range tests {
+		if got := Sanitize(tt.text, tt.n); got != tt.want {
+			t.Errorf("Sanitize(%q, %d) = %q, want %q", tt.text, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errCBOR = errors.New("webauthn: malformed cbor")
+
+const maxCBORDepth = 16
+
+// decodeCBOR decodes the first CBOR item in data and returns the remaining
+// bytes. Only the subset used by WebAuthn is supported: integers, byte and
+// text strings, arrays, maps, booleans and null. Map keys are int64 or string.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeItem(data, 0)
+}
+
+func decodeItem(data []byte, depth int) (any, []byte, error) {
+	if len(data) == 0 || depth > maxCBORDepth {
+		return nil, nil, errCBOR
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	arg, rest, err := decodeArgument(info, data[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0: // unsigned int
+		if arg > math.MaxInt64 {
+			return nil, nil, errCBOR
+		}
+		return int64(arg), rest, nil
+	case 1: // negative int
+		if arg > math.MaxInt64 {
+			return nil, nil, errCBOR
+		}
+		return -1 - int64(arg), rest, nil
+	case 2, 3: // byte string, text string
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBOR
+		}
+		b := rest[:arg]
+		if major == 3 {
+			return string(b), rest[arg:], nil
+		}
+		return append([]byte(nil), b...), rest[arg:], nil
+	case 4: // array
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBOR
+		}
+		arr := make([]any, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var v any
+			v, rest, err = decodeItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, rest, nil
+	case 5: // map
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBOR
+		}
+		m := make(map[any]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			var k, v any
+			k, rest, err = decodeItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errCBOR
+			}
+			v, rest, err = decodeItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			m[k] = v
+		}
+		return m, rest, nil
+	case 7: // simple values
+		switch info {
+		case 20:
+			return false, rest, nil
+		case 21:
+			return true, rest, nil
+		case 22:
+			return nil, rest, nil
+		}
+	}
+
+	return nil, nil, errCBOR
+}
+
+// decodeArgument reads the length/value that follows the initial byte.
+// Indefinite lengths are not used by WebAuthn and are rejected.
+func decodeArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	}
+
+	return 0, nil, errCBOR
+}
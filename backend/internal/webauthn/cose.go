@@ -0,0 +1,115 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithm identifiers offered to authenticators, in preference order.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+var (
+	ErrUnsupportedKey = errors.New("webauthn: unsupported public key")
+	ErrBadSignature   = errors.New("webauthn: invalid signature")
+)
+
+// parseCOSEKey decodes a COSE_Key into a crypto public key.
+func parseCOSEKey(coseKey []byte) (crypto.PublicKey, error) {
+	v, _, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := v.(map[any]any)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+
+	kty, _ := key[int64(1)].(int64)
+	alg, _ := key[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == AlgES256: // EC2
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrUnsupportedKey
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+
+	case kty == 1 && alg == AlgEdDSA: // OKP
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+
+		return ed25519.PublicKey(x), nil
+
+	case kty == 3 && alg == AlgRS256: // RSA
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrUnsupportedKey
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	}
+
+	return nil, ErrUnsupportedKey
+}
+
+// verifySignature checks sig over data with a COSE_Key encoded public key.
+func verifySignature(coseKey, data, sig []byte) error {
+	key, err := parseCOSEKey(coseKey)
+	if err != nil {
+		return err
+	}
+
+	switch pub := key.(type) {
+	case *ecdsa.PublicKey:
+		// WebAuthn ES256 signatures are ASN.1 DER encoded
+		var esig struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &esig); err != nil {
+			return ErrBadSignature
+		}
+
+		digest := sha256.Sum256(data)
+		if !ecdsa.Verify(pub, digest[:], esig.R, esig.S) {
+			return ErrBadSignature
+		}
+
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, data, sig) {
+			return ErrBadSignature
+		}
+
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return ErrBadSignature
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package webauthn
+
+// The option types mirror PublicKeyCredentialCreationOptions and
+// PublicKeyCredentialRequestOptions in their JSON form, which browsers accept
+// through PublicKeyCredential.parse*OptionsFromJSON().
+
+type rpEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type credentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     rpEntity               `json:"rp"`
+	User                   userEntity             `json:"user"`
+	PubKeyCredParams       []credentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+	ExcludeCredentials     []credentialDescriptor `json:"excludeCredentials"`
+}
+
+type RequestOptions struct {
+	Challenge        string `json:"challenge"`
+	RPID             string `json:"rpId"`
+	Timeout          int64  `json:"timeout"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions builds the options for registering a passkey. Existing
+// credential ids are excluded so the same authenticator isn't added twice.
+func (w *WebAuthn) CreationOptions(challenge string, userID int64, username string, existing [][]byte) CreationOptions {
+	exclude := make([]credentialDescriptor, len(existing))
+	for i, id := range existing {
+		exclude[i] = credentialDescriptor{Type: "public-key", ID: Encode(id)}
+	}
+
+	return CreationOptions{
+		Challenge: challenge,
+		RP:        rpEntity{ID: w.cfg.RPID, Name: w.cfg.RPName},
+		User: userEntity{
+			ID:          Encode(UserHandle(userID)),
+			Name:        username,
+			DisplayName: username,
+		},
+		PubKeyCredParams: []credentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:     Timeout.Milliseconds(),
+		Attestation: "none",
+		AuthenticatorSelection: authenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: "preferred",
+		},
+		ExcludeCredentials: exclude,
+	}
+}
+
+// RequestOptions builds the options for signing in with a discoverable
+// credential, so no user has to be known up front.
+func (w *WebAuthn) RequestOptions(challenge string) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             w.cfg.RPID,
+		Timeout:          Timeout.Milliseconds(),
+		UserVerification: "preferred",
+	}
+}
@@ -0,0 +1,315 @@
+package webauthn
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const Timeout = time.Minute * 5
+
+var (
+	ErrInvalidResponse  = errors.New("webauthn: invalid authenticator response")
+	ErrChallenge        = errors.New("webauthn: challenge does not match")
+	ErrOrigin           = errors.New("webauthn: origin does not match")
+	ErrRPID             = errors.New("webauthn: relying party does not match")
+	ErrUserNotPresent   = errors.New("webauthn: user presence is required")
+	ErrClonedCredential = errors.New("webauthn: signature counter went backwards, the credential may be cloned")
+)
+
+// authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+type Config struct {
+	RPID   string // domain of the frontend, e.g. "grace.app"
+	RPName string
+	Origin string // full origin the browser reports, e.g. "https://grace.app"
+}
+
+// WebAuthn runs registration and assertion ceremonies for one relying party.
+// Only "none" attestation is requested, so attestation statements are not
+// verified; the credential's key is trusted on first use like a password.
+type WebAuthn struct {
+	cfg Config
+}
+
+func New(cfg Config) *WebAuthn {
+	return &WebAuthn{cfg: cfg}
+}
+
+// Credential is a newly registered public key credential.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key
+	SignCount uint32
+}
+
+// Assertion is the outcome of a successful sign-in ceremony.
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// RegistrationResponse is the JSON form of the PublicKeyCredential returned
+// by navigator.credentials.create(). Binary fields are base64url encoded.
+// Fields the server doesn't use are declared so strict JSON decoding accepts
+// the browser's toJSON() output as is.
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON     string   `json:"clientDataJSON"`
+		AttestationObject  string   `json:"attestationObject"`
+		AuthenticatorData  string   `json:"authenticatorData,omitempty"`
+		Transports         []string `json:"transports,omitempty"`
+		PublicKey          string   `json:"publicKey,omitempty"`
+		PublicKeyAlgorithm int      `json:"publicKeyAlgorithm,omitempty"`
+	} `json:"response"`
+	AuthenticatorAttachment string          `json:"authenticatorAttachment,omitempty"`
+	ClientExtensionResults  json.RawMessage `json:"clientExtensionResults,omitempty"`
+}
+
+// AssertionResponse is the JSON form of the PublicKeyCredential returned by
+// navigator.credentials.get(). Binary fields are base64url encoded.
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+	AuthenticatorAttachment string          `json:"authenticatorAttachment,omitempty"`
+	ClientExtensionResults  json.RawMessage `json:"clientExtensionResults,omitempty"`
+}
+
+// NewChallenge returns a random base64url encoded challenge.
+func NewChallenge() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// UserHandle is the opaque user id stored on the authenticator. It must not
+// contain personal data, so it is just the big endian user id.
+func UserHandle(userID int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(userID))
+	return b
+}
+
+// ChallengeOf returns the challenge a response was made for, so the pending
+// ceremony can be looked up before verification.
+func ChallengeOf(clientDataJSON string) (string, error) {
+	raw, err := Decode(clientDataJSON)
+	if err != nil {
+		return "", ErrInvalidResponse
+	}
+
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return "", ErrInvalidResponse
+	}
+
+	return cd.Challenge, nil
+}
+
+// VerifyRegistration checks a registration response against the challenge
+// that was issued for it and extracts the new credential.
+func (w *WebAuthn) VerifyRegistration(res *RegistrationResponse, challenge string) (*Credential, error) {
+	if res.Type != "public-key" {
+		return nil, ErrInvalidResponse
+	}
+
+	if err := w.verifyClientData(res.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	attObj, err := Decode(res.Response.AttestationObject)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	v, _, err := decodeCBOR(attObj)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	att, ok := v.(map[any]any)
+	if !ok {
+		return nil, ErrInvalidResponse
+	}
+
+	authData, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, ErrInvalidResponse
+	}
+
+	flags, signCount, rest, err := w.parseAuthData(authData)
+	if err != nil {
+		return nil, err
+	}
+
+	if flags&flagAttestedData == 0 || len(rest) < 18 {
+		return nil, ErrInvalidResponse
+	}
+
+	// attested credential data: aaguid(16) | idLen(2) | id | COSE key
+	rest = rest[16:]
+	idLen := int(binary.BigEndian.Uint16(rest))
+	rest = rest[2:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return nil, ErrInvalidResponse
+	}
+	credID := rest[:idLen]
+	rest = rest[idLen:]
+
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	publicKey := rest[:len(rest)-len(after)]
+
+	// make sure the key is one we can verify signatures with
+	if _, err := parseCOSEKey(publicKey); err != nil {
+		return nil, err
+	}
+
+	rawID, err := Decode(res.RawID)
+	if err != nil || subtle.ConstantTimeCompare(rawID, credID) != 1 {
+		return nil, ErrInvalidResponse
+	}
+
+	return &Credential{
+		ID:        append([]byte(nil), credID...),
+		PublicKey: append([]byte(nil), publicKey...),
+		SignCount: signCount,
+	}, nil
+}
+
+// VerifyAssertion checks a sign-in response against the challenge that was
+// issued for it and the stored credential.
+func (w *WebAuthn) VerifyAssertion(res *AssertionResponse, challenge string, publicKey []byte, storedCount uint32) (*Assertion, error) {
+	if res.Type != "public-key" {
+		return nil, ErrInvalidResponse
+	}
+
+	if err := w.verifyClientData(res.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	authData, err := Decode(res.Response.AuthenticatorData)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	flags, signCount, _, err := w.parseAuthData(authData)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataJSON, err := Decode(res.Response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	sig, err := Decode(res.Response.Signature)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authData...), clientDataHash[:]...)
+
+	if err := verifySignature(publicKey, signed, sig); err != nil {
+		return nil, err
+	}
+
+	// authenticators that keep a counter must increase it on every use
+	if (signCount != 0 || storedCount != 0) && signCount <= storedCount {
+		return nil, ErrClonedCredential
+	}
+
+	return &Assertion{
+		SignCount:    signCount,
+		UserVerified: flags&flagUserVerified != 0,
+	}, nil
+}
+
+func (w *WebAuthn) verifyClientData(encoded, typ, challenge string) error {
+	raw, err := Decode(encoded)
+	if err != nil {
+		return ErrInvalidResponse
+	}
+
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return ErrInvalidResponse
+	}
+
+	if cd.Type != typ {
+		return ErrInvalidResponse
+	}
+
+	if subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(challenge)) != 1 {
+		return ErrChallenge
+	}
+
+	if cd.Origin != w.cfg.Origin {
+		return ErrOrigin
+	}
+
+	return nil
+}
+
+// parseAuthData checks the fixed authenticator data header and returns the
+// flags, signature counter and whatever follows the header.
+func (w *WebAuthn) parseAuthData(authData []byte) (byte, uint32, []byte, error) {
+	if len(authData) < 37 {
+		return 0, 0, nil, ErrInvalidResponse
+	}
+
+	rpIDHash := sha256.Sum256([]byte(w.cfg.RPID))
+	if subtle.ConstantTimeCompare(authData[:32], rpIDHash[:]) != 1 {
+		return 0, 0, nil, ErrRPID
+	}
+
+	flags := authData[32]
+	if flags&flagUserPresent == 0 {
+		return 0, 0, nil, ErrUserNotPresent
+	}
+
+	return flags, binary.BigEndian.Uint32(authData[33:37]), authData[37:], nil
+}
+
+// Decode decodes base64url, with or without padding.
+func Decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// Encode encodes bytes as unpadded base64url.
+func Encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
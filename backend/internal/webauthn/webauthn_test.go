@@ -0,0 +1,448 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+var testConfig = Config{
+	RPID:   "grace.app",
+	RPName: "Grace",
+	Origin: "https://grace.app",
+}
+
+// cborMap keeps map entries in order, which the decoder doesn't care about
+// but makes the encoded keys deterministic.
+type cborMap [][2]any
+
+// encodeCBOR encodes the subset of CBOR the software authenticator needs.
+func encodeCBOR(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case cborMap:
+		b := head(5, uint64(len(v)))
+		for _, kv := range v {
+			b = append(b, encodeCBOR(kv[0])...)
+			b = append(b, encodeCBOR(kv[1])...)
+		}
+		return b
+	}
+
+	panic("encodeCBOR: unsupported type")
+}
+
+// authenticator is a software security key holding a single credential.
+type authenticator struct {
+	rpID      string
+	origin    string
+	id        []byte
+	key       crypto.Signer
+	signCount uint32
+	flags     byte
+}
+
+func newAuthenticator(t *testing.T, alg int) *authenticator {
+	t.Helper()
+
+	var key crypto.Signer
+	var err error
+
+	switch alg {
+	case AlgES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return &authenticator{
+		rpID:   testConfig.RPID,
+		origin: testConfig.Origin,
+		id:     id,
+		key:    key,
+		flags:  flagUserPresent | flagUserVerified,
+	}
+}
+
+// coseKey encodes the public key as a COSE_Key.
+func (a *authenticator) coseKey() []byte {
+	switch pub := a.key.Public().(type) {
+	case *ecdsa.PublicKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		return encodeCBOR(cborMap{{1, 2}, {3, AlgES256}, {-1, 1}, {-2, x}, {-3, y}})
+	case ed25519.PublicKey:
+		return encodeCBOR(cborMap{{1, 1}, {3, AlgEdDSA}, {-1, 6}, {-2, []byte(pub)}})
+	case *rsa.PublicKey:
+		return encodeCBOR(cborMap{{1, 3}, {3, AlgRS256}, {-1, pub.N.Bytes()}, {-2, big.NewInt(int64(pub.E)).Bytes()}})
+	}
+
+	panic("coseKey: unsupported key")
+}
+
+func (a *authenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+
+	flags := a.flags
+	if attested {
+		flags |= flagAttestedData
+	}
+
+	b := append(rpIDHash[:], flags)
+	b = binary.BigEndian.AppendUint32(b, a.signCount)
+
+	if attested {
+		b = append(b, make([]byte, 16)...) // aaguid
+		b = binary.BigEndian.AppendUint16(b, uint16(len(a.id)))
+		b = append(b, a.id...)
+		b = append(b, a.coseKey()...)
+	}
+
+	return b
+}
+
+func (a *authenticator) clientData(typ, challenge string) []byte {
+	b, _ := json.Marshal(map[string]any{
+		"type":        typ,
+		"challenge":   challenge,
+		"origin":      a.origin,
+		"crossOrigin": false,
+	})
+	return b
+}
+
+// register answers navigator.credentials.create() for the challenge.
+func (a *authenticator) register(challenge string) *RegistrationResponse {
+	attObj := encodeCBOR(cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", a.authData(true)},
+	})
+
+	res := &RegistrationResponse{
+		ID:    Encode(a.id),
+		RawID: Encode(a.id),
+		Type:  "public-key",
+	}
+	res.Response.ClientDataJSON = Encode(a.clientData("webauthn.create", challenge))
+	res.Response.AttestationObject = Encode(attObj)
+
+	return res
+}
+
+// assert answers navigator.credentials.get() for the challenge, counting
+// the use like a hardware key would.
+func (a *authenticator) assert(t *testing.T, challenge string) *AssertionResponse {
+	t.Helper()
+
+	a.signCount++
+
+	authData := a.authData(false)
+	clientData := a.clientData("webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	signed := append(append([]byte(nil), authData...), clientDataHash[:]...)
+
+	var sig []byte
+	var err error
+
+	switch key := a.key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(key, signed)
+	default:
+		digest := sha256.Sum256(signed)
+		sig, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := &AssertionResponse{
+		ID:    Encode(a.id),
+		RawID: Encode(a.id),
+		Type:  "public-key",
+	}
+	res.Response.ClientDataJSON = Encode(clientData)
+	res.Response.AuthenticatorData = Encode(authData)
+	res.Response.Signature = Encode(sig)
+	res.Response.UserHandle = Encode(UserHandle(1))
+
+	return res
+}
+
+func challenge(t *testing.T) string {
+	t.Helper()
+
+	c, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCeremonies(t *testing.T) {
+	w := New(testConfig)
+
+	for _, alg := range []int{AlgES256, AlgEdDSA, AlgRS256} {
+		a := newAuthenticator(t, alg)
+
+		c := challenge(t)
+		cred, err := w.VerifyRegistration(a.register(c), c)
+		if err != nil {
+			t.Fatalf("alg %d: registration: %v", alg, err)
+		}
+
+		if string(cred.ID) != string(a.id) || cred.SignCount != 0 {
+			t.Fatalf("alg %d: unexpected credential %+v", alg, cred)
+		}
+
+		stored := cred.SignCount
+		for range 3 {
+			c := challenge(t)
+			assertion, err := w.VerifyAssertion(a.assert(t, c), c, cred.PublicKey, stored)
+			if err != nil {
+				t.Fatalf("alg %d: assertion: %v", alg, err)
+			}
+
+			if assertion.SignCount != a.signCount || !assertion.UserVerified {
+				t.Fatalf("alg %d: unexpected assertion %+v", alg, assertion)
+			}
+			stored = assertion.SignCount
+		}
+	}
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	w := New(testConfig)
+
+	tests := []struct {
+		name   string
+		modify func(a *authenticator, res *RegistrationResponse, c *string)
+		want   error
+	}{
+		{"wrong challenge", func(a *authenticator, res *RegistrationResponse, c *string) { *c = "other" }, ErrChallenge},
+		{"wrong origin", func(a *authenticator, res *RegistrationResponse, c *string) {
+			a.origin = "https://evil.example.com"
+			*res = *a.register(*c)
+		}, ErrOrigin},
+		{"wrong relying party", func(a *authenticator, res *RegistrationResponse, c *string) {
+			a.rpID = "evil.example.com"
+			*res = *a.register(*c)
+		}, ErrRPID},
+		{"user not present", func(a *authenticator, res *RegistrationResponse, c *string) {
+			a.flags = 0
+			*res = *a.register(*c)
+		}, ErrUserNotPresent},
+		{"assertion client data", func(a *authenticator, res *RegistrationResponse, c *string) {
+			res.Response.ClientDataJSON = Encode(a.clientData("webauthn.get", *c))
+		}, ErrInvalidResponse},
+		{"raw id mismatch", func(a *authenticator, res *RegistrationResponse, c *string) {
+			res.RawID = Encode([]byte("another credential"))
+		}, ErrInvalidResponse},
+		{"wrong type", func(a *authenticator, res *RegistrationResponse, c *string) { res.Type = "password" }, ErrInvalidResponse},
+		{"garbage attestation", func(a *authenticator, res *RegistrationResponse, c *string) {
+			res.Response.AttestationObject = Encode([]byte{0xff, 0x00})
+		}, ErrInvalidResponse},
+		{"unsupported key", func(a *authenticator, res *RegistrationResponse, c *string) {
+			// an EC2 key on P-384 under the ES256 algorithm
+			authData := a.authData(false)
+			authData[32] |= flagAttestedData
+			authData = append(authData, make([]byte, 16)...)
+			authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.id)))
+			authData = append(authData, a.id...)
+			authData = append(authData, encodeCBOR(cborMap{{1, 2}, {3, AlgES256}, {-1, 2}, {-2, make([]byte, 48)}, {-3, make([]byte, 48)}})...)
+			res.Response.AttestationObject = Encode(encodeCBOR(cborMap{{"fmt", "none"}, {"attStmt", cborMap{}}, {"authData", authData}}))
+		}, ErrUnsupportedKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthenticator(t, AlgES256)
+
+			c := challenge(t)
+			res := a.register(c)
+			tt.modify(a, res, &c)
+
+			if _, err := w.VerifyRegistration(res, c); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	w := New(testConfig)
+
+	a := newAuthenticator(t, AlgES256)
+
+	c := challenge(t)
+	cred, err := w.VerifyRegistration(a.register(c), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := newAuthenticator(t, AlgES256)
+
+	tests := []struct {
+		name      string
+		signer    *authenticator
+		challenge string
+		modify    func(res *AssertionResponse)
+		want      error
+	}{
+		{"wrong challenge", a, "other", nil, ErrChallenge},
+		{"other key", other, "", nil, ErrBadSignature},
+		{"tampered signature", a, "", func(res *AssertionResponse) {
+			sig, _ := Decode(res.Response.Signature)
+			sig[len(sig)-1] ^= 0xff
+			res.Response.Signature = Encode(sig)
+		}, ErrBadSignature},
+		{"tampered client data", a, "", func(res *AssertionResponse) {
+			res.Response.ClientDataJSON = Encode(a.clientData("webauthn.get", c+"x"))
+		}, ErrChallenge},
+		{"truncated authenticator data", a, "", func(res *AssertionResponse) {
+			res.Response.AuthenticatorData = Encode(make([]byte, 36))
+		}, ErrInvalidResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := challenge(t)
+
+			res := tt.signer.assert(t, c)
+			if tt.modify != nil {
+				tt.modify(res)
+			}
+
+			if tt.challenge != "" {
+				c = tt.challenge
+			}
+
+			if _, err := w.VerifyAssertion(res, c, cred.PublicKey, 0); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignCount(t *testing.T) {
+	w := New(testConfig)
+
+	tests := []struct {
+		name   string
+		stored uint32
+		count  uint32
+		want   error
+	}{
+		{"increased", 5, 6, nil},
+		{"jumped ahead", 5, 100, nil},
+		{"no counter", 0, 0, nil},
+		{"repeated", 5, 5, ErrClonedCredential},
+		{"rolled back", 5, 4, ErrClonedCredential},
+		{"reset to zero", 5, 0, ErrClonedCredential},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthenticator(t, AlgEdDSA)
+
+			c := challenge(t)
+			cred, err := w.VerifyRegistration(a.register(c), c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// assert increments before signing
+			a.signCount = tt.count - 1
+
+			c = challenge(t)
+			assertion, err := w.VerifyAssertion(a.assert(t, c), c, cred.PublicKey, tt.stored)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+
+			if err == nil && assertion.SignCount != tt.count {
+				t.Fatalf("sign count = %d, want %d", assertion.SignCount, tt.count)
+			}
+		})
+	}
+}
+
+func TestChallengeOf(t *testing.T) {
+	a := newAuthenticator(t, AlgEdDSA)
+
+	c := challenge(t)
+
+	got, err := ChallengeOf(Encode(a.clientData("webauthn.create", c)))
+	if err != nil || got != c {
+		t.Fatalf("ChallengeOf() = %q, %v, want %q", got, err, c)
+	}
+
+	if _, err := ChallengeOf("not base64!"); err != ErrInvalidResponse {
+		t.Fatalf("got %v, want %v", err, ErrInvalidResponse)
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"map", encodeCBOR(cborMap{{1, "a"}, {"b", []byte{1}}}), true},
+		{"negative", encodeCBOR(-257), true},
+		{"empty", nil, false},
+		{"truncated string", []byte{0x45, 1, 2}, false},
+		{"indefinite length", []byte{0x5f}, false},
+		{"huge array", []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, false},
+		{"array key", []byte{0xa1, 0x80, 0x01}, false},
+		{"too deep", append(bytes.Repeat([]byte{0x81}, maxCBORDepth+2), 0x00), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeCBOR(tt.data); (err == nil) != tt.ok {
+				t.Fatalf("decodeCBOR() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}